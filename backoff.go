@@ -0,0 +1,43 @@
+package xrabbitmq
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// backoff 指数退避策略，用于断线重连等需要逐步拉长等待时间的场景
+type backoff struct {
+	// Initial 第一次重试前的等待时间
+	Initial time.Duration
+
+	// Max 等待时间的上限
+	Max time.Duration
+
+	// Multiplier 每次重试后等待时间的增长倍数
+	Multiplier float64
+
+	// Jitter 随机抖动比例(0~1)，避免大量客户端在同一时刻重连
+	Jitter float64
+}
+
+// duration 得到第attempt(从0开始)次重试前需要等待的时间
+func (b backoff) duration(attempt int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(b.Initial) * math.Pow(multiplier, float64(attempt))
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		jitter := b.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		// 在 [d*(1-jitter), d*(1+jitter)] 区间内随机取值
+		d = d * (1 - jitter + 2*jitter*rand.Float64())
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,47 @@
+package xrabbitmq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDuration(t *testing.T) {
+	cases := []struct {
+		name    string
+		backoff backoff
+		attempt int
+		want    time.Duration
+	}{
+		{"first attempt", backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2}, 0, time.Second},
+		{"grows by multiplier", backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2}, 3, 8 * time.Second},
+		{"capped at max", backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2}, 10, time.Minute},
+		{"no max", backoff{Initial: time.Second, Multiplier: 2}, 10, 1024 * time.Second},
+		{"multiplier below one stays constant", backoff{Initial: time.Second, Max: time.Minute, Multiplier: 0.5}, 5, time.Second},
+	}
+	for _, c := range cases {
+		if got := c.backoff.duration(c.attempt); got != c.want {
+			t.Errorf("%s: duration(%d) = %s, want %s", c.name, c.attempt, got, c.want)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	cases := []struct {
+		name     string
+		backoff  backoff
+		attempt  int
+		min, max time.Duration
+	}{
+		{"jitter around base", backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2, Jitter: 0.2}, 1, 1600 * time.Millisecond, 2400 * time.Millisecond},
+		{"jitter applied after max", backoff{Initial: time.Second, Max: 10 * time.Second, Multiplier: 2, Jitter: 0.5}, 10, 5 * time.Second, 15 * time.Second},
+		{"jitter above one clamped", backoff{Initial: time.Second, Multiplier: 1, Jitter: 3}, 0, 0, 2 * time.Second},
+	}
+	for _, c := range cases {
+		for i := 0; i < 1000; i++ {
+			if got := c.backoff.duration(c.attempt); got < c.min || got > c.max {
+				t.Errorf("%s: duration(%d) = %s, want within [%s, %s]", c.name, c.attempt, got, c.min, c.max)
+				break
+			}
+		}
+	}
+}
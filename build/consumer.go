@@ -2,6 +2,7 @@ package build
 
 import (
 	"fmt"
+	"xrabbitmq/pkg/consumer/headers"
 	"xrabbitmq/pkg/consumer/publish"
 	"xrabbitmq/pkg/consumer/routing"
 	"xrabbitmq/pkg/consumer/simple"
@@ -31,10 +32,29 @@ func (cb *consumerBuild) sess() *session.Session {
 	return session.NewSession(cb.sessionOptions...)
 }
 
-func (cb *consumerBuild) rabbitMqConn() *external.XConnection {
+func (cb *consumerBuild) depend() depend {
 	builder := depend{}
 	cb.buildRequired(&builder)
-	return builder.conn
+	return builder
+}
+
+// establish 为会话建立通信管道
+func (cb *consumerBuild) establish(sess *session.Session) error {
+	if _, err := sess.DeadLetter(); err != nil {
+		return err
+	}
+	// 由RabbitMQ生成名字的队列每次重连都会换名，为它声明的延迟队列/死信队列会不断泄漏
+	if len(sess.OptionsConsumer().RetryDelays) > 0 && sess.Queue().Name == "" {
+		return fmt.Errorf("retry requires the \"queue's Name\" to be specified")
+	}
+	return sess.Establish(cb.depend().conn)
+}
+
+// register 登记构建出来的消费者，以便断线重连后恢复及关闭时排空
+func (cb *consumerBuild) register(c Client) {
+	if registry := cb.depend().registry; registry != nil {
+		registry.Register(c)
+	}
 }
 
 func (cb *consumerBuild) Simple() (external.Consumer, error) {
@@ -52,11 +72,13 @@ func (cb *consumerBuild) Simple() (external.Consumer, error) {
 	if sess.Queue().Name == "" {
 		return nil, fmt.Errorf("consumerBuild Simple error: the \"queue's Name\" must be specified")
 	}
-	err := sess.Establish(cb.rabbitMqConn())
+	err := cb.establish(sess)
 	if err != nil {
 		return nil, fmt.Errorf("consumerBuild Simple error: %w", err)
 	}
-	return simple.New(sess), nil
+	c := simple.New(sess)
+	cb.register(c)
+	return c, nil
 }
 
 func (cb *consumerBuild) Work() (external.Consumer, error) {
@@ -74,11 +96,13 @@ func (cb *consumerBuild) Work() (external.Consumer, error) {
 	if sess.Queue().Name == "" {
 		return nil, fmt.Errorf("consumerBuild Work error: the \"queue's Name\" must be specified")
 	}
-	err := sess.Establish(cb.rabbitMqConn())
+	err := cb.establish(sess)
 	if err != nil {
 		return nil, fmt.Errorf("consumerBuild Work error: %w", err)
 	}
-	return work.New(sess), nil
+	c := work.New(sess)
+	cb.register(c)
+	return c, nil
 }
 
 func (cb *consumerBuild) Publish() (external.Consumer, error) {
@@ -100,11 +124,13 @@ func (cb *consumerBuild) Publish() (external.Consumer, error) {
 		return nil, fmt.Errorf("consumerBuild Publish error: the \"exchange's Name\" must be specified")
 	}
 
-	err := sess.Establish(cb.rabbitMqConn())
+	err := cb.establish(sess)
 	if err != nil {
 		return nil, fmt.Errorf("consumerBuild Publish error: %w", err)
 	}
-	return publish.New(sess), nil
+	c := publish.New(sess)
+	cb.register(c)
+	return c, nil
 }
 
 func (cb *consumerBuild) Routing() (external.Consumer, error) {
@@ -122,15 +148,19 @@ func (cb *consumerBuild) Routing() (external.Consumer, error) {
 		return nil, fmt.Errorf("consumerBuild Routing error: the \"exchange's Name\" must be specified")
 	}
 
-	if sess.Binding().RoutingKey == "" {
-		return nil, fmt.Errorf("consumerBuild Routing error: the \"binding's RoutingKey\" must be specified")
+	for _, b := range sess.Bindings() {
+		if b.RoutingKey == "" {
+			return nil, fmt.Errorf("consumerBuild Routing error: the \"binding's RoutingKey\" must be specified")
+		}
 	}
 
-	err := sess.Establish(cb.rabbitMqConn())
+	err := cb.establish(sess)
 	if err != nil {
 		return nil, fmt.Errorf("consumerBuild Routing error: %w", err)
 	}
-	return routing.New(sess), nil
+	c := routing.New(sess)
+	cb.register(c)
+	return c, nil
 }
 
 func (cb *consumerBuild) Topic() (external.Consumer, error) {
@@ -147,13 +177,56 @@ func (cb *consumerBuild) Topic() (external.Consumer, error) {
 	if sess.Exchange().Name == "" {
 		return nil, fmt.Errorf("consumerBuild Topic error: the \"exchange's Name\" must be specified")
 	}
-	if sess.Binding().RoutingKey == "" {
-		return nil, fmt.Errorf("consumerBuild Topic error: the \"binding's RoutingKey\" must be specified")
+	for _, b := range sess.Bindings() {
+		if b.RoutingKey == "" {
+			return nil, fmt.Errorf("consumerBuild Topic error: the \"binding's RoutingKey\" must be specified")
+		}
 	}
 
-	err := sess.Establish(cb.rabbitMqConn())
+	err := cb.establish(sess)
 	if err != nil {
 		return nil, fmt.Errorf("consumerBuild Routing error: %w", err)
 	}
-	return topic.New(sess), nil
+	c := topic.New(sess)
+	cb.register(c)
+	return c, nil
+}
+
+func (cb *consumerBuild) Headers() (external.Consumer, error) {
+	cb.sessionOptions = append(cb.sessionOptions, session.WithBrokerOptions(
+		broker.WithQueue(queue.SetName(""),
+			queue.SetExclusive(true),
+		),
+		broker.WithExchange(
+			exchange.SetDurable(true),
+			exchange.SetType(external.XExchangeHeaders),
+		),
+		broker.WithBinding(
+			binding.SetRoutingKey(""),
+		),
+	))
+	sess := cb.sess()
+	if sess.Exchange().Name == "" {
+		return nil, fmt.Errorf("consumerBuild Headers error: the \"exchange's Name\" must be specified")
+	}
+	// 每个绑定除x-match外至少需要一个要匹配的消息头
+	for _, b := range sess.Bindings() {
+		var predicates int
+		for k := range b.Args {
+			if k != "x-match" {
+				predicates++
+			}
+		}
+		if predicates == 0 {
+			return nil, fmt.Errorf("consumerBuild Headers error: the \"binding's Headers\" must be specified")
+		}
+	}
+
+	err := cb.establish(sess)
+	if err != nil {
+		return nil, fmt.Errorf("consumerBuild Headers error: %w", err)
+	}
+	c := headers.New(sess)
+	cb.register(c)
+	return c, nil
 }
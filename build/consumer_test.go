@@ -0,0 +1,61 @@
+package build
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+	"xrabbitmq/pkg/session/broker"
+	"xrabbitmq/pkg/session/broker/binding"
+	"xrabbitmq/pkg/session/broker/exchange"
+	"xrabbitmq/pkg/session/consumeropts"
+)
+
+func TestRetryRejectsServerNamedQueues(t *testing.T) {
+	retry := session.WithConsumerOptions(consumeropts.WithRetry(0, time.Second))
+	events := session.WithBrokerOptions(broker.WithExchange(exchange.SetName("events"), exchange.SetType(external.XExchangeTopic)))
+	keyed := session.WithBrokerOptions(broker.WithBinding(binding.SetRoutingKey("orders.#")))
+	tenant := session.WithBrokerOptions(broker.WithBinding(binding.WithHeaders(external.XTable{"tenant": "a"})))
+	cases := []struct {
+		name    string
+		binding session.Option
+		build   func(cb *consumerBuild) (external.Consumer, error)
+	}{
+		{"publish", keyed, (*consumerBuild).Publish},
+		{"routing", keyed, (*consumerBuild).Routing},
+		{"topic", keyed, (*consumerBuild).Topic},
+		{"headers", tenant, (*consumerBuild).Headers},
+	}
+	for _, c := range cases {
+		// 没有连接：校验在建立通信管道之前完成
+		cb := NewConsumerBuild(DependConn(nil), retry, events, c.binding)
+		_, err := c.build(cb)
+		if err == nil || !strings.Contains(err.Error(), "retry requires") {
+			t.Errorf("%s: build error = %v, want retry rejected", c.name, err)
+		}
+	}
+}
+
+func TestHeadersRequiresMatchedHeaders(t *testing.T) {
+	tenants := session.WithBrokerOptions(broker.WithExchange(exchange.SetName("tenants")))
+	cases := []struct {
+		name string
+		opts []session.Option
+		err  string
+	}{
+		{"no exchange", []session.Option{session.WithBrokerOptions(broker.WithBinding(binding.WithHeaders(external.XTable{"tenant": "a"})))}, "exchange's Name"},
+		{"no headers", []session.Option{tenants}, "binding's Headers"},
+		{"x-match only", []session.Option{tenants, session.WithBrokerOptions(broker.WithBinding(binding.SetMatchAny()))}, "binding's Headers"},
+		{"additional binding without headers", []session.Option{tenants, session.WithBrokerOptions(
+			broker.WithBinding(binding.WithHeaders(external.XTable{"tenant": "a"})),
+			broker.WithBindings(binding.New("", "", external.XTable{"x-match": "all"})),
+		)}, "binding's Headers"},
+	}
+	for _, c := range cases {
+		_, err := NewConsumerBuild(DependConn(nil), c.opts...).Headers()
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: Headers error = %v, want containing %q", c.name, err, c.err)
+		}
+	}
+}
@@ -1,13 +1,35 @@
 package build
 
 import (
+	"context"
 	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/pool"
+	"xrabbitmq/pkg/session"
 )
 
 type Required func(*depend)
 
+// Client 构建出来的生产者/消费者
+type Client interface {
+	// Sess 生产者/消费者所持有的会话
+	Sess() *session.Session
+
+	// Drain 停止接收新的消息，并等待手头的消息处理完毕；ctx到期时返回被放弃的情况
+	Drain(ctx context.Context) error
+}
+
+// Registry 生产者/消费者的登记处，由RabbitMQ客户端实现
+// 登记后的会话会在断线重连后自动重建通信管道，RabbitMQ客户端关闭时会排空登记的生产者/消费者
+type Registry interface {
+	Register(c Client)
+}
+
 type depend struct {
 	conn *external.XConnection
+
+	registry Registry
+
+	pool *pool.Pool
 }
 
 func DependConn(conn *external.XConnection) Required {
@@ -15,3 +37,25 @@ func DependConn(conn *external.XConnection) Required {
 		b.conn = conn
 	}
 }
+
+func DependRegistry(registry Registry) Required {
+	return func(b *depend) {
+		b.registry = registry
+	}
+}
+
+// DependPool 生产者从通信管道池中借用通信管道
+func DependPool(p *pool.Pool) Required {
+	return func(b *depend) {
+		b.pool = p
+	}
+}
+
+// Depends 组合多个依赖项
+func Depends(rs ...Required) Required {
+	return func(b *depend) {
+		for _, r := range rs {
+			r(b)
+		}
+	}
+}
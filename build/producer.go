@@ -3,6 +3,7 @@ package build
 import (
 	"fmt"
 	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/producer/headers"
 	"xrabbitmq/pkg/producer/publish"
 	"xrabbitmq/pkg/producer/routing"
 	"xrabbitmq/pkg/producer/simple"
@@ -31,10 +32,26 @@ func (cb *producerBuild) sess() *session.Session {
 	return session.NewSession(cb.sessionOptions...)
 }
 
-func (cb *producerBuild) rabbitMqConn() *external.XConnection {
+func (cb *producerBuild) depend() depend {
 	builder := depend{}
 	cb.buildRequired(&builder)
-	return builder.conn
+	return builder
+}
+
+// establish 为会话建立通信管道，配置了通信管道池时会话使用池，发送时再从池中借用
+func (cb *producerBuild) establish(sess *session.Session) error {
+	d := cb.depend()
+	if d.pool != nil {
+		return sess.EstablishFrom(d.pool)
+	}
+	return sess.Establish(d.conn)
+}
+
+// register 登记构建出来的生产者，以便断线重连后恢复及关闭时排空
+func (cb *producerBuild) register(c Client) {
+	if registry := cb.depend().registry; registry != nil {
+		registry.Register(c)
+	}
 }
 
 func (cb *producerBuild) Simple() (external.Producer, error) {
@@ -52,11 +69,13 @@ func (cb *producerBuild) Simple() (external.Producer, error) {
 	if sess.Queue().Name == "" {
 		return nil, fmt.Errorf("producerBuild Simple error: the \"queue's Name\" must be specified")
 	}
-	err := sess.Establish(cb.rabbitMqConn())
+	err := cb.establish(sess)
 	if err != nil {
 		return nil, fmt.Errorf("producerBuild Simple error: %w", err)
 	}
-	return simple.New(sess), nil
+	p := simple.New(sess)
+	cb.register(p)
+	return p, nil
 }
 
 func (cb *producerBuild) Work() (external.Producer, error) {
@@ -74,11 +93,13 @@ func (cb *producerBuild) Work() (external.Producer, error) {
 	if sess.Queue().Name == "" {
 		return nil, fmt.Errorf("producerBuild Work error: the \"queue's Name\" must be specified")
 	}
-	err := sess.Establish(cb.rabbitMqConn())
+	err := cb.establish(sess)
 	if err != nil {
 		return nil, fmt.Errorf("producerBuild Work error: %w", err)
 	}
-	return work.New(sess), nil
+	p := work.New(sess)
+	cb.register(p)
+	return p, nil
 }
 
 func (cb *producerBuild) Publish() (external.Producer, error) {
@@ -96,11 +117,13 @@ func (cb *producerBuild) Publish() (external.Producer, error) {
 	if sess.Exchange().Name == "" {
 		return nil, fmt.Errorf("producerBuild Publish error: the \"exchange's Name\" must be specified")
 	}
-	err := sess.Establish(cb.rabbitMqConn())
+	err := cb.establish(sess)
 	if err != nil {
 		return nil, fmt.Errorf("producerBuild Publish error: %w", err)
 	}
-	return publish.New(sess), nil
+	p := publish.New(sess)
+	cb.register(p)
+	return p, nil
 }
 
 func (cb *producerBuild) Routing(dynamic bool) (external.Producer, error) {
@@ -119,20 +142,24 @@ func (cb *producerBuild) Routing(dynamic bool) (external.Producer, error) {
 	}
 
 	if dynamic {
-		err := sess.Establish(cb.rabbitMqConn())
+		err := cb.establish(sess)
 		if err != nil {
 			return nil, fmt.Errorf("producerBuild Routing Dynamic error: %w", err)
 		}
-		return routing.NewDynamic(sess), nil
+		p := routing.NewDynamic(sess)
+		cb.register(p)
+		return p, nil
 	} else {
 		if sess.Binding().RoutingKey == "" {
 			return nil, fmt.Errorf("producerBuild Routing error: the \"binding's RoutingKey\" must be specified")
 		}
-		err := sess.Establish(cb.rabbitMqConn())
+		err := cb.establish(sess)
 		if err != nil {
 			return nil, fmt.Errorf("producerBuild Routing error: %w", err)
 		}
-		return routing.New(sess), nil
+		p := routing.New(sess)
+		cb.register(p)
+		return p, nil
 	}
 }
 
@@ -152,19 +179,47 @@ func (cb *producerBuild) Topic(dynamic bool) (external.Producer, error) {
 	}
 
 	if dynamic {
-		err := sess.Establish(cb.rabbitMqConn())
+		err := cb.establish(sess)
 		if err != nil {
 			return nil, fmt.Errorf("producerBuild Topic Dynamic error: %w", err)
 		}
-		return topic.NewDynamic(sess), nil
+		p := topic.NewDynamic(sess)
+		cb.register(p)
+		return p, nil
 	} else {
 		if sess.Binding().RoutingKey == "" {
 			return nil, fmt.Errorf("producerBuild Topic error: the \"binding's RoutingKey\" must be specified")
 		}
-		err := sess.Establish(cb.rabbitMqConn())
+		err := cb.establish(sess)
 		if err != nil {
 			return nil, fmt.Errorf("producerBuild Topic error: %w", err)
 		}
-		return topic.New(sess), nil
+		p := topic.New(sess)
+		cb.register(p)
+		return p, nil
+	}
+}
+
+func (cb *producerBuild) Headers() (external.Producer, error) {
+	cb.sessionOptions = append(cb.sessionOptions, session.WithBrokerOptions(
+		broker.WithQueue(queue.SetName(""),
+			queue.SetExclusive(true),
+		),
+		broker.WithExchange(
+			exchange.SetDurable(true),
+			exchange.SetType(external.XExchangeHeaders),
+		),
+	))
+	sess := cb.sess()
+
+	if sess.Exchange().Name == "" {
+		return nil, fmt.Errorf("producerBuild Headers error: the \"exchange's Name\" must be specified")
+	}
+	err := cb.establish(sess)
+	if err != nil {
+		return nil, fmt.Errorf("producerBuild Headers error: %w", err)
 	}
+	p := headers.New(sess)
+	cb.register(p)
+	return p, nil
 }
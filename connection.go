@@ -0,0 +1,223 @@
+package xrabbitmq
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/pool"
+)
+
+// role 连接的用途
+type role int
+
+const (
+	// roleShared 生产者与消费者共用的连接
+	roleShared role = iota
+	// rolePublisher 生产者专用的连接
+	rolePublisher
+	// roleConsumer 消费者专用的连接
+	roleConsumer
+)
+
+func (r role) String() string {
+	switch r {
+	case rolePublisher:
+		return "publisher"
+	case roleConsumer:
+		return "consumer"
+	default:
+		return "shared"
+	}
+}
+
+// connection RabbitMQ客户端管理的一个连接
+// 每个连接独立地监听异常、断线重连，并恢复建立在它上面的生产者/消费者
+type connection struct {
+	// mu 保护conn与channel，断线重连后它们会被替换
+	mu sync.RWMutex
+
+	// rabbitMQ 客户端连接
+	conn *external.XConnection
+
+	// rabbitMq 通信管道
+	channel *external.XChannel
+
+	// closes/blocks 在连接被其它goroutine看到之前注册的关闭/阻塞监听者，
+	// 避免连接在注册前断开时amqp直接关闭监听者而漏掉断开的原因
+	closes chan *external.XError
+	blocks chan external.XBlocking
+
+	// role 连接的用途
+	role role
+
+	// index 同一用途的连接中的序号
+	index int
+
+	// clients 建立在该连接上的生产者/消费者，断线重连后需要恢复，关闭时需要排空
+	clients registry
+
+	// pool 生产者共享的通信管道池，仅生产者可用的连接在配置了池大小时才有
+	pool *pool.Pool
+
+	// 以下为健康检查所需的状态，由mu保护
+	state         State
+	blocked       bool
+	blockedReason string
+	lastErr       error
+	lastErrAt     time.Time
+	connectedAt   time.Time
+	reconnects    int
+}
+
+// Conn 得到当前的连接，断线重连后得到的是新建立的连接
+func (c *connection) Conn() *external.XConnection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+// set 替换当前持有的连接与通信管道
+func (c *connection) set(conn *external.XConnection, channel *external.XChannel) {
+	var (
+		closes chan *external.XError
+		blocks chan external.XBlocking
+	)
+	if conn != nil {
+		closes = conn.NotifyClose(make(chan *external.XError, 1))
+		blocks = conn.NotifyBlocked(make(chan external.XBlocking, 1))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn, c.channel = conn, channel
+	c.closes, c.blocks = closes, blocks
+	c.blocked, c.blockedReason = false, ""
+	if conn != nil {
+		c.state, c.connectedAt = StateConnected, time.Now()
+	} else {
+		c.state = StateIdle
+	}
+}
+
+// notifications 得到当前连接上注册的关闭/阻塞监听者
+func (c *connection) notifications() (chan *external.XError, chan external.XBlocking) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closes, c.blocks
+}
+
+// abandonOnClose 关闭期间重连已经停止，连接断开后未被确认的消息不会再被确认：
+// 关闭建立在该连接上的会话，唤醒等待会话恢复的生产者，使它们以ErrClosed结束未被确认的消息
+// stop关闭时(排空结束)不再监听；连接断开且有生产者/消费者时返回错误
+func (c *connection) abandonOnClose(stop <-chan struct{}) error {
+	if conn := c.Conn(); conn != nil && !conn.IsClosed() {
+		select {
+		case <-conn.NotifyClose(make(chan *external.XError, 1)):
+		case <-stop:
+			return nil
+		}
+	}
+	if len(c.clients.snapshot()) == 0 {
+		return nil
+	}
+	c.clients.close()
+	return fmt.Errorf("AMQP connection %s lost during shutdown, unconfirmed messages failed", c)
+}
+
+// setState 更新连接状态
+func (c *connection) setState(state State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state = state
+}
+
+// setBlocked 更新连接是否被broker阻塞
+func (c *connection) setBlocked(blocked bool, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blocked, c.blockedReason = blocked, reason
+}
+
+// fail 记录连接上发生的错误
+func (c *connection) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastErr, c.lastErrAt = err, time.Now()
+}
+
+// reconnected 记录一次成功的断线重连
+func (c *connection) reconnected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reconnects++
+}
+
+// name 得到在RabbitMQ管理界面中显示的连接名称
+// 只有一个连接时与配置的名称一致，否则加上用途与序号以便区分
+func (c *connection) name(base string, single bool) string {
+	if base == "" || single {
+		return base
+	}
+	return fmt.Sprintf("%s-%s-%d", base, c.role, c.index)
+}
+
+// String 用于日志
+func (c *connection) String() string {
+	return fmt.Sprintf("%s#%d", c.role, c.index)
+}
+
+// connections 按照用途分组的连接
+type connections struct {
+	// all 所有的连接，第一个为主连接
+	all []*connection
+
+	publishers []*connection
+	consumers  []*connection
+
+	// nextPublisher/nextConsumer 轮流选取连接的计数器
+	nextPublisher uint32
+	nextConsumer  uint32
+}
+
+// newConnections 根据配置项划分连接
+// 未配置专用连接时，生产者与消费者共用同一个连接
+func newConnections(opts ConfOptions) connections {
+	var cs connections
+	if opts.PublisherConns <= 0 && opts.ConsumerConns <= 0 {
+		c := &connection{role: roleShared}
+		cs.all = []*connection{c}
+		cs.publishers = cs.all
+		cs.consumers = cs.all
+		return cs
+	}
+
+	for i := 0; i < max(opts.PublisherConns, 1); i++ {
+		cs.publishers = append(cs.publishers, &connection{role: rolePublisher, index: i})
+	}
+	for i := 0; i < max(opts.ConsumerConns, 1); i++ {
+		cs.consumers = append(cs.consumers, &connection{role: roleConsumer, index: i})
+	}
+	cs.all = append(append(cs.all, cs.publishers...), cs.consumers...)
+	return cs
+}
+
+// publisher 轮流选取一个生产者可用的连接
+func (cs *connections) publisher() *connection {
+	n := atomic.AddUint32(&cs.nextPublisher, 1)
+	return cs.publishers[int(n-1)%len(cs.publishers)]
+}
+
+// consumer 轮流选取一个消费者可用的连接
+func (cs *connections) consumer() *connection {
+	n := atomic.AddUint32(&cs.nextConsumer, 1)
+	return cs.consumers[int(n-1)%len(cs.consumers)]
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
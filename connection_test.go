@@ -0,0 +1,60 @@
+package xrabbitmq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewConnections(t *testing.T) {
+	cases := []struct {
+		name       string
+		opts       []ConfOption
+		all        []string
+		publishers []string
+		consumers  []string
+	}{
+		{"shared", nil, []string{"shared#0"}, []string{"shared#0", "shared#0", "shared#0"}, []string{"shared#0", "shared#0", "shared#0"}},
+		{"separate", []ConfOption{WithConnections(2, 1)}, []string{"publisher#0", "publisher#1", "consumer#0"}, []string{"publisher#0", "publisher#1", "publisher#0"}, []string{"consumer#0", "consumer#0", "consumer#0"}},
+		{"only consumers", []ConfOption{WithConnections(0, 2)}, []string{"publisher#0", "consumer#0", "consumer#1"}, []string{"publisher#0", "publisher#0", "publisher#0"}, []string{"consumer#0", "consumer#1", "consumer#0"}},
+	}
+	for _, c := range cases {
+		cs := newConnections(defaultConfOptions(c.opts...))
+		var all, publishers, consumers []string
+		for _, conn := range cs.all {
+			all = append(all, conn.String())
+		}
+		// 轮流选取连接
+		for i := 0; i < 3; i++ {
+			publishers = append(publishers, cs.publisher().String())
+			consumers = append(consumers, cs.consumer().String())
+		}
+		if !reflect.DeepEqual(all, c.all) {
+			t.Errorf("%s: connections = %v, want %v", c.name, all, c.all)
+		}
+		if !reflect.DeepEqual(publishers, c.publishers) {
+			t.Errorf("%s: publishers picked %v, want %v", c.name, publishers, c.publishers)
+		}
+		if !reflect.DeepEqual(consumers, c.consumers) {
+			t.Errorf("%s: consumers picked %v, want %v", c.name, consumers, c.consumers)
+		}
+	}
+}
+
+func TestConnectionName(t *testing.T) {
+	cases := []struct {
+		name   string
+		base   string
+		single bool
+		conn   *connection
+		want   string
+	}{
+		{"unnamed", "", false, &connection{role: rolePublisher}, ""},
+		{"single connection keeps name", "orders", true, &connection{role: roleShared}, "orders"},
+		{"suffixed by role and index", "orders", false, &connection{role: roleConsumer, index: 1}, "orders-consumer-1"},
+	}
+	for _, c := range cases {
+		if got := c.conn.name(c.base, c.single); got != c.want {
+			t.Errorf("%s: name = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package xrabbitmq
+
+import (
+	"sync"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+)
+
+// events 连接生命周期事件的监听者及回调
+type events struct {
+	mu sync.Mutex
+
+	// reconnects 重连成功事件的监听者
+	reconnects []chan *external.XConnection
+
+	// disconnects 连接异常断开事件的监听者
+	disconnects []chan *external.XError
+
+	// 各类事件的回调
+	onBlocked     []func(reason string)
+	onUnblocked   []func()
+	onClosed      []func(err *external.XError)
+	onReconnected []func(conn *external.XConnection)
+}
+
+// NotifyReconnect 注册一个监听者，每次断线重连成功后会将新的连接发送给它
+// 发送是非阻塞的，建议传入带缓冲的channel；RabbitMQ客户端关闭时会关闭该channel
+func (rmq *RabbitMQ) NotifyReconnect(receiver chan *external.XConnection) chan *external.XConnection {
+	rmq.events.mu.Lock()
+	defer rmq.events.mu.Unlock()
+	rmq.events.reconnects = append(rmq.events.reconnects, receiver)
+	return receiver
+}
+
+// NotifyDisconnect 注册一个监听者，连接异常断开时会将断开的原因发送给它
+// 发送是非阻塞的，建议传入带缓冲的channel；RabbitMQ客户端关闭时会关闭该channel
+func (rmq *RabbitMQ) NotifyDisconnect(receiver chan *external.XError) chan *external.XError {
+	rmq.events.mu.Lock()
+	defer rmq.events.mu.Unlock()
+	rmq.events.disconnects = append(rmq.events.disconnects, receiver)
+	return receiver
+}
+
+// OnBlocked 注册回调，当broker因内存/磁盘告警阻塞连接时被调用，reason为告警原因
+// 此时发送的消息都会被broker挂起，一般应当暂停生产者
+// 回调在监听连接的goroutine中同步执行，应当尽快返回
+func (rmq *RabbitMQ) OnBlocked(fn func(reason string)) {
+	rmq.events.mu.Lock()
+	defer rmq.events.mu.Unlock()
+	rmq.events.onBlocked = append(rmq.events.onBlocked, fn)
+}
+
+// OnUnblocked 注册回调，当broker解除对连接的阻塞时被调用
+func (rmq *RabbitMQ) OnUnblocked(fn func()) {
+	rmq.events.mu.Lock()
+	defer rmq.events.mu.Unlock()
+	rmq.events.onUnblocked = append(rmq.events.onUnblocked, fn)
+}
+
+// OnClosed 注册回调，当连接关闭时被调用
+// 连接异常断开时err为断开的原因，通过Shutdown主动关闭时err为nil
+func (rmq *RabbitMQ) OnClosed(fn func(err *external.XError)) {
+	rmq.events.mu.Lock()
+	defer rmq.events.mu.Unlock()
+	rmq.events.onClosed = append(rmq.events.onClosed, fn)
+}
+
+// OnReconnected 注册回调，断线重连成功且会话恢复后被调用
+func (rmq *RabbitMQ) OnReconnected(fn func(conn *external.XConnection)) {
+	rmq.events.mu.Lock()
+	defer rmq.events.mu.Unlock()
+	rmq.events.onReconnected = append(rmq.events.onReconnected, fn)
+}
+
+func (e *events) blocked(reason string) {
+	e.mu.Lock()
+	fns := append(([]func(string))(nil), e.onBlocked...)
+	e.mu.Unlock()
+	for _, fn := range fns {
+		safeCall(func() { fn(reason) })
+	}
+}
+
+func (e *events) unblocked() {
+	e.mu.Lock()
+	fns := append(([]func())(nil), e.onUnblocked...)
+	e.mu.Unlock()
+	for _, fn := range fns {
+		safeCall(fn)
+	}
+}
+
+func (e *events) closed(xerr *external.XError) {
+	e.mu.Lock()
+	fns := append(([]func(*external.XError))(nil), e.onClosed...)
+	if xerr != nil {
+		for _, c := range e.disconnects {
+			select {
+			case c <- xerr:
+			default:
+				log.Logger.Warning("disconnect listener is busy, event dropped.")
+			}
+		}
+	}
+	e.mu.Unlock()
+	for _, fn := range fns {
+		safeCall(func() { fn(xerr) })
+	}
+}
+
+func (e *events) reconnected(conn *external.XConnection) {
+	e.mu.Lock()
+	fns := append(([]func(*external.XConnection))(nil), e.onReconnected...)
+	for _, c := range e.reconnects {
+		select {
+		case c <- conn:
+		default:
+			log.Logger.Warning("reconnect listener is busy, event dropped.")
+		}
+	}
+	e.mu.Unlock()
+	for _, fn := range fns {
+		safeCall(func() { fn(conn) })
+	}
+}
+
+// close 关闭所有的事件监听者
+func (e *events) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, c := range e.reconnects {
+		close(c)
+	}
+	for _, c := range e.disconnects {
+		close(c)
+	}
+	e.reconnects, e.disconnects = nil, nil
+}
+
+// safeCall 调用用户注册的回调，避免回调中的panic影响连接的监听
+func safeCall(fn func()) {
+	defer func() {
+		if x := recover(); x != nil {
+			log.Logger.Errorf("event callback panic: %+v", x)
+		}
+	}()
+	fn()
+}
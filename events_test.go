@@ -0,0 +1,78 @@
+package xrabbitmq
+
+import (
+	"reflect"
+	"testing"
+	"xrabbitmq/pkg/external"
+)
+
+func TestEventCallbacks(t *testing.T) {
+	rmq := New()
+	var got []string
+	rmq.OnBlocked(func(reason string) { got = append(got, "blocked: "+reason) })
+	rmq.OnBlocked(func(string) { panic("boom") })
+	rmq.OnUnblocked(func() { got = append(got, "unblocked") })
+	rmq.OnClosed(func(err *external.XError) {
+		if err == nil {
+			got = append(got, "closed")
+		} else {
+			got = append(got, "closed: "+err.Reason)
+		}
+	})
+	rmq.OnReconnected(func(*external.XConnection) { got = append(got, "reconnected") })
+
+	rmq.events.blocked("low on memory")
+	rmq.events.unblocked()
+	rmq.events.closed(&external.XError{Reason: "CONNECTION_FORCED"})
+	rmq.events.reconnected(nil)
+	rmq.events.closed(nil)
+
+	// 回调panic不影响之后的回调
+	want := []string{"blocked: low on memory", "unblocked", "closed: CONNECTION_FORCED", "reconnected", "closed"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("callbacks = %v, want %v", got, want)
+	}
+}
+
+func TestEventListeners(t *testing.T) {
+	cases := []struct {
+		name        string
+		disconnects []*external.XError
+		reconnects  int
+		// wantDisconnects/wantReconnects 监听者收到的事件数，监听者已满时事件被丢弃
+		wantDisconnects int
+		wantReconnects  int
+	}{
+		{"none", nil, 0, 0, 0},
+		{"one each", []*external.XError{{Reason: "a"}}, 1, 1, 1},
+		{"shutdown not a disconnect", []*external.XError{nil}, 0, 0, 0},
+		{"busy listener drops", []*external.XError{{Reason: "a"}, {Reason: "b"}}, 2, 1, 1},
+	}
+	for _, c := range cases {
+		rmq := New()
+		disconnects := rmq.NotifyDisconnect(make(chan *external.XError, 1))
+		reconnects := rmq.NotifyReconnect(make(chan *external.XConnection, 1))
+		for _, xerr := range c.disconnects {
+			rmq.events.closed(xerr)
+		}
+		for i := 0; i < c.reconnects; i++ {
+			rmq.events.reconnected(nil)
+		}
+		rmq.events.close()
+
+		n := 0
+		for range disconnects {
+			n++
+		}
+		if n != c.wantDisconnects {
+			t.Errorf("%s: received %d disconnects, want %d", c.name, n, c.wantDisconnects)
+		}
+		n = 0
+		for range reconnects {
+			n++
+		}
+		if n != c.wantReconnects {
+			t.Errorf("%s: received %d reconnects, want %d", c.name, n, c.wantReconnects)
+		}
+	}
+}
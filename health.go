@@ -0,0 +1,212 @@
+package xrabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// State 连接状态
+type State int
+
+const (
+	// StateIdle 尚未建立连接
+	StateIdle State = iota
+	// StateConnected 已建立连接
+	StateConnected
+	// StateReconnecting 连接异常断开，正在重连
+	StateReconnecting
+	// StateClosed 连接已关闭：RabbitMQ客户端已关闭、未开启自动重连或放弃了重连
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	default:
+		return "idle"
+	}
+}
+
+// MarshalText 健康检查以文本形式输出连接状态
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ConnectionHealth 一个连接的健康状况
+type ConnectionHealth struct {
+	// Name 连接的用途及序号，如shared#0、publisher#1
+	Name string `json:"name"`
+
+	// State 连接状态
+	State State `json:"state"`
+
+	// Blocked/BlockedReason broker是否因内存/磁盘告警阻塞了该连接及告警原因
+	Blocked       bool   `json:"blocked"`
+	BlockedReason string `json:"blocked_reason,omitempty"`
+
+	// Sessions 建立在该连接上仍然存活的生产者/消费者会话数
+	Sessions int `json:"sessions"`
+
+	// Channels 该连接上开辟的通信管道数，包括通信管道池中空闲的通信管道
+	Channels int `json:"channels"`
+
+	// LastError/LastErrorAt 最近一次连接异常断开或重连失败的原因及时间
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitempty"`
+
+	// ConnectedAt 最近一次成功建立连接(包括断线重连)的时间
+	ConnectedAt time.Time `json:"connected_at,omitempty"`
+
+	// SinceConnected 距离最近一次成功建立连接的时长，未建立连接时为0
+	SinceConnected time.Duration `json:"since_connected"`
+
+	// Reconnects 断线重连成功的次数
+	Reconnects int `json:"reconnects"`
+
+	// ProbeError 在连接上开辟通信管道进行探测时的错误，只有DeepHealth会探测
+	ProbeError string `json:"probe_error,omitempty"`
+}
+
+// Health RabbitMQ客户端的健康状况
+type Health struct {
+	Connections []ConnectionHealth `json:"connections"`
+}
+
+// Live 是否存活，存在已放弃重连的连接时只能通过重启恢复
+func (h Health) Live() bool {
+	for _, c := range h.Connections {
+		if c.State == StateClosed {
+			return false
+		}
+	}
+	return true
+}
+
+// Ready 是否可以正常收发消息：所有连接均已建立、未被broker阻塞且探测(如果有)成功
+func (h Health) Ready() bool {
+	for _, c := range h.Connections {
+		if c.State != StateConnected || c.Blocked || c.ProbeError != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Health 得到RabbitMQ客户端已记录的健康状况：连接状态、阻塞告警及会话/通信管道数
+// 不与broker交互，可以被频繁调用
+func (rmq *RabbitMQ) Health() Health {
+	h := Health{Connections: make([]ConnectionHealth, 0, len(rmq.conns.all))}
+	for _, c := range rmq.conns.all {
+		h.Connections = append(h.Connections, c.health())
+	}
+	return h
+}
+
+// DeepHealth 在Health的基础上，对已建立的连接开辟并关闭一个通信管道，确认broker仍然可以响应
+// ctx用于控制探测的超时；每次调用都会开辟通信管道，不适合高频调用
+func (rmq *RabbitMQ) DeepHealth(ctx context.Context) Health {
+	h := rmq.Health()
+	for i, c := range rmq.conns.all {
+		if h.Connections[i].State != StateConnected {
+			continue
+		}
+		if err := c.probe(ctx); err != nil {
+			h.Connections[i].ProbeError = err.Error()
+		}
+	}
+	return h
+}
+
+// HealthHandler 得到用于Kubernetes存活/就绪探针的http.Handler
+// 默认按照就绪状态响应，请求参数probe=live时按照存活状态响应；
+// 默认只报告已记录的状态，请求参数deep=true时才通过开辟通信管道探测broker(见DeepHealth)；
+// 状态正常时返回200，否则返回503，响应体为JSON格式的健康状况
+func (rmq *RabbitMQ) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var h Health
+		if query.Get("deep") == "true" {
+			h = rmq.DeepHealth(r.Context())
+		} else {
+			h = rmq.Health()
+		}
+
+		ok := h.Ready()
+		if query.Get("probe") == "live" {
+			ok = h.Live()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if ok {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(h)
+	})
+}
+
+// health 得到连接c已记录的健康状况
+func (c *connection) health() ConnectionHealth {
+	sessions := c.clients.snapshot()
+
+	c.mu.RLock()
+	h := ConnectionHealth{
+		Name:          c.String(),
+		State:         c.state,
+		Blocked:       c.blocked,
+		BlockedReason: c.blockedReason,
+		Sessions:      len(sessions),
+		LastErrorAt:   c.lastErrAt,
+		ConnectedAt:   c.connectedAt,
+		Reconnects:    c.reconnects,
+	}
+	if c.lastErr != nil {
+		h.LastError = c.lastErr.Error()
+	}
+	if c.channel != nil {
+		h.Channels++
+	}
+	c.mu.RUnlock()
+
+	if h.State == StateConnected {
+		h.SinceConnected = time.Since(h.ConnectedAt)
+	}
+	for _, s := range sessions {
+		if !s.Sess().Pooled() && s.Sess().HasEstablished() {
+			h.Channels++
+		}
+	}
+	if c.pool != nil {
+		idle, inUse := c.pool.Stats()
+		h.Channels += idle + inUse
+	}
+	return h
+}
+
+// probe 在连接上开辟并关闭一个通信管道，确认broker仍然可以响应
+func (c *connection) probe(ctx context.Context) error {
+	conn := c.Conn()
+	done := make(chan error, 1)
+	go func() {
+		channel, err := conn.Channel()
+		if err == nil {
+			err = channel.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,65 @@
+package xrabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	cases := []struct {
+		name    string
+		states  []State
+		blocked bool
+		query   string
+		code    int
+	}{
+		{"connected", []State{StateConnected, StateConnected}, false, "", http.StatusOK},
+		{"not yet connected", []State{StateIdle, StateConnected}, false, "", http.StatusServiceUnavailable},
+		{"reconnecting is live", []State{StateReconnecting, StateConnected}, false, "?probe=live", http.StatusOK},
+		{"reconnecting not ready", []State{StateReconnecting, StateConnected}, false, "", http.StatusServiceUnavailable},
+		{"blocked is live", []State{StateConnected, StateConnected}, true, "?probe=live", http.StatusOK},
+		{"blocked not ready", []State{StateConnected, StateConnected}, true, "", http.StatusServiceUnavailable},
+		{"given up", []State{StateClosed, StateConnected}, false, "?probe=live", http.StatusServiceUnavailable},
+	}
+	for _, c := range cases {
+		rmq := New(WithConnections(1, 1))
+		for i, state := range c.states {
+			rmq.conns.all[i].setState(state)
+		}
+		if c.blocked {
+			rmq.conns.all[1].setBlocked(true, "low on memory")
+		}
+		rmq.conns.all[0].fail(errors.New("connection reset"))
+
+		w := httptest.NewRecorder()
+		rmq.HealthHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health"+c.query, nil))
+		if w.Code != c.code {
+			t.Errorf("%s: status = %d, want %d", c.name, w.Code, c.code)
+		}
+
+		var h struct {
+			Connections []struct {
+				Name      string `json:"name"`
+				State     string `json:"state"`
+				Blocked   bool   `json:"blocked"`
+				LastError string `json:"last_error"`
+			} `json:"connections"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &h); err != nil {
+			t.Fatalf("%s: decode health: %s", c.name, err)
+		}
+		if len(h.Connections) != 2 {
+			t.Fatalf("%s: %d connections reported, want 2", c.name, len(h.Connections))
+		}
+		first, second := h.Connections[0], h.Connections[1]
+		if first.Name != "publisher#0" || first.State != c.states[0].String() || first.LastError != "connection reset" {
+			t.Errorf("%s: reported %+v", c.name, first)
+		}
+		if second.Name != "consumer#0" || second.Blocked != c.blocked {
+			t.Errorf("%s: reported %+v", c.name, second)
+		}
+	}
+}
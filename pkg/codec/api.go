@@ -15,3 +15,8 @@ type Codec interface {
 	Marshaler
 	Unmarshaler
 }
+
+// ContentTyper 解码器可选实现，得到编码结果的MIME类型，发送消息时用作ContentType
+type ContentTyper interface {
+	ContentType() string
+}
@@ -1,11 +1,29 @@
 package codec
 
 import (
+	"errors"
+	"fmt"
+	"mime"
+	"sync"
 	"xrabbitmq/pkg/codec/json"
+	"xrabbitmq/pkg/codec/protobuf"
 )
 
+// ErrUnknownContentType 没有为消息的ContentType注册解码器
+var ErrUnknownContentType = errors.New("codec: unknown content type")
+
 var defaultCodec Codec = json.NewCodec()
 
+var (
+	mu sync.RWMutex
+
+	// codecs 按照ContentType注册的解码器
+	codecs = map[string]Codec{
+		"application/json":       json.NewCodec(),
+		"application/x-protobuf": protobuf.NewCodec(),
+	}
+)
+
 func Marshal(v interface{}) ([]byte, error) {
 	return defaultCodec.Marshal(v)
 }
@@ -14,6 +32,47 @@ func Unmarshal(data []byte, v interface{}) error {
 	return defaultCodec.Unmarshal(data, v)
 }
 
+// SetCodec 替换默认的解码器，解码器实现了ContentTyper时同时按照其ContentType注册
 func SetCodec(c Codec) {
 	defaultCodec = c
+	if ct, ok := c.(ContentTyper); ok {
+		Register(ct.ContentType(), c)
+	}
+}
+
+// ContentType 得到当前解码器编码结果的MIME类型
+// 解码器未实现ContentTyper时为"application/octet-stream"
+func ContentType() string {
+	if ct, ok := defaultCodec.(ContentTyper); ok {
+		return ct.ContentType()
+	}
+	return "application/octet-stream"
+}
+
+// Register 为ContentType注册解码器，消费者根据消息的ContentType选择解码器
+func Register(contentType string, c Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	codecs[mediaType(contentType)] = c
+}
+
+// ForContentType 得到ContentType对应的解码器，ContentType为空时得到默认的解码器
+func ForContentType(contentType string) (Codec, error) {
+	if contentType == "" {
+		return defaultCodec, nil
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if c, ok := codecs[mediaType(contentType)]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownContentType, contentType)
+}
+
+// mediaType 去掉ContentType中的参数，如"application/json; charset=utf-8"得到"application/json"
+func mediaType(contentType string) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	return contentType
 }
@@ -0,0 +1,68 @@
+package codec
+
+import (
+	"errors"
+	"testing"
+	"xrabbitmq/pkg/codec/json"
+	"xrabbitmq/pkg/codec/protobuf"
+)
+
+// plainCodec 没有实现ContentTyper的解码器
+type plainCodec struct{}
+
+func (plainCodec) Marshal(v interface{}) ([]byte, error) {
+	return nil, nil
+}
+
+func (plainCodec) Unmarshal(data []byte, v interface{}) error {
+	return nil
+}
+
+func TestContentType(t *testing.T) {
+	old := defaultCodec
+	defer SetCodec(old)
+
+	cases := []struct {
+		name  string
+		codec Codec
+		want  string
+	}{
+		{"json", json.NewCodec(), "application/json"},
+		{"protobuf", protobuf.NewCodec(), "application/x-protobuf"},
+		{"without content type", plainCodec{}, "application/octet-stream"},
+	}
+	for _, c := range cases {
+		SetCodec(c.codec)
+		if got := ContentType(); got != c.want {
+			t.Errorf("%s: ContentType = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestForContentType(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		want        Codec
+		known       bool
+	}{
+		{"empty uses default", "", defaultCodec, true},
+		{"json", "application/json", codecs["application/json"], true},
+		{"parameters ignored", "application/json; charset=utf-8", codecs["application/json"], true},
+		{"protobuf", "application/x-protobuf", codecs["application/x-protobuf"], true},
+		{"unknown", "text/csv", nil, false},
+	}
+	for _, c := range cases {
+		got, err := ForContentType(c.contentType)
+		if c.known != (err == nil) {
+			t.Errorf("%s: ForContentType error = %v, want known = %v", c.name, err, c.known)
+			continue
+		}
+		if !c.known && !errors.Is(err, ErrUnknownContentType) {
+			t.Errorf("%s: error = %v, want ErrUnknownContentType", c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: ForContentType = %T, want %T", c.name, got, c.want)
+		}
+	}
+}
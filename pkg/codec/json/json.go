@@ -12,6 +12,11 @@ func NewCodec() *Codec {
 	return &Codec{}
 }
 
+// ContentType returns the MIME type of the JSON encoding.
+func (s *Codec) ContentType() string {
+	return "application/json"
+}
+
 // Marshal returns the JSON encoding of v.
 func (s *Codec) Marshal(v interface{}) ([]byte, error) {
 	return json.Marshal(v)
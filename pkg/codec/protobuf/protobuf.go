@@ -16,6 +16,11 @@ func NewCodec() *Codec {
 	return &Codec{}
 }
 
+// ContentType returns the MIME type of the protobuf encoding.
+func (s *Codec) ContentType() string {
+	return "application/x-protobuf"
+}
+
 // Marshal returns the protobuf encoding of v.
 func (s *Codec) Marshal(v interface{}) ([]byte, error) {
 	pb, ok := v.(proto.Message)
@@ -1,13 +1,24 @@
 package consumer
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
 	"xrabbitmq/pkg/external"
 	"xrabbitmq/pkg/internal/utils"
 	"xrabbitmq/pkg/log"
 	"xrabbitmq/pkg/session"
-	"sync"
 )
 
+// tagSeq 用于生成进程内唯一的消费者标识
+var tagSeq uint64
+
+// DeclareFunc 在通信管道上声明消费者所需的交换机/队列/binding，并返回要消费的队列名
+// 会话恢复后会被再次调用，所以必须是幂等的
+type DeclareFunc func(channel *external.XChannel) (string, error)
+
 type Consumer struct {
 	// session 消费者与交换机/队列/binding的声明保障
 	// 消费者会占用一个RabbitMQ的通信管道，不要忘记使用 Consumer.Cancel() 来释放它
@@ -25,13 +36,36 @@ type Consumer struct {
 
 	// consumer model simple/work/publish/routing/topic
 	model Model
+
+	// prefetch 通过Qos设置的预取数量，会话恢复后需要重新设置
+	prefetch int
+
+	// tag 消费者标识，未通过配置项指定时自动生成，用于取消订阅
+	tag string
+
+	// inflight 正在被handler处理的消息数
+	inflight utils.Counter
+
+	// queue 正在消费的队列名，用于延迟重试
+	queue atomic.Value
+
+	// retrier 延迟重试专用的、开启了消息确认的通信管道
+	retrier retrier
+
+	// bindings 消费过程中通过Bind/Unbind变更的绑定
+	bindings bindings
 }
 
 func NewConsumer(sess *session.Session, mod Model) *Consumer {
+	tag := sess.OptionsConsumer().Tag
+	if tag == "" {
+		tag = fmt.Sprintf("xrabbitmq-%d-%d", os.Getpid(), atomic.AddUint64(&tagSeq, 1))
+	}
 	return &Consumer{
 		session: sess,
 		done:    make(chan error),
 		model:   mod,
+		tag:     tag,
 	}
 }
 
@@ -47,18 +81,114 @@ func (c *Consumer) Model() Model {
 	return c.model
 }
 
-func (c *Consumer) Consume(d <-chan external.XDelivery, handler func(delivery external.XDelivery)) {
-	c.deliveries = d
+// Consume 声明交换机/队列/binding并开始消费，阻塞式
+// 通信管道因断线等原因被重建后，会重新声明、重新设置Qos并重新订阅，handler继续接收消息
+// 配置了Concurrency时，消息被分发给多个goroutine并发处理
+func (c *Consumer) Consume(declare DeclareFunc, handler func(delivery external.XDelivery)) error {
+	dispatch, stop := c.workers(handler)
+	defer stop()
+
+	channel := c.session.Channel()
+	for {
+		deliveries, err := c.subscribe(channel, declare)
+		if err != nil {
+			return err
+		}
+		c.deliveries = deliveries
+
+		log.Logger.Info("consumer.Consume.handler: deliveries channel starting...")
+
+		for delivery := range deliveries {
+			dispatch(delivery)
+		}
+
+		log.Logger.Info("consumer.Consume.handler: deliveries channel closed...")
+
+		var ok bool
+		if channel, ok = c.session.WaitRecovered(channel); !ok {
+			return nil
+		}
+		log.Logger.Warningf("%s: session recovered, re-subscribe now.", c.model)
+	}
+}
 
-	log.Logger.Info("consumer.Consume.handler: deliveries channel starting...")
+// subscribe 在通信管道上设置Qos、声明交换机/队列/binding并订阅
+func (c *Consumer) subscribe(channel *external.XChannel, declare DeclareFunc) (<-chan external.XDelivery, error) {
+	prefetch := c.prefetch
+	if n := c.session.OptionsConsumer().Concurrency; n > prefetch {
+		prefetch = n
+	}
+	if prefetch > 0 {
+		if err := channel.Qos(prefetch, 0, false); err != nil {
+			log.Logger.Errorf("%s.Qos error: %s.", c.model, err)
+			return nil, err
+		}
+	}
 
-	// handle all consumer errors, if required re-connect
-	// there are problems with reconnection logic for now
-	for delivery := range c.deliveries {
-		handler(delivery)
+	if err := c.declareDeadLetter(channel); err != nil {
+		return nil, err
 	}
+	name, err := declare(channel)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.declareBound(channel, name); err != nil {
+		return nil, err
+	}
+	if c.retrying() {
+		if err := c.declareRetry(channel, name); err != nil {
+			return nil, err
+		}
+	}
+	c.queue.Store(name)
+
+	consumerOptions := c.session.OptionsConsumer()
+	deliveries, err := channel.Consume(
+		name,
+		c.tag,
+		consumerOptions.AutoAck,
+		consumerOptions.NoLocal,
+		consumerOptions.Exclusive,
+		consumerOptions.NoWait,
+		consumerOptions.Args,
+	)
+	if err != nil {
+		log.Logger.Errorf("%s.Consume error: %s.", c.model, err)
+		return nil, err
+	}
+	return deliveries, nil
+}
 
-	log.Logger.Info("consumer.Consume.handler: deliveries channel closed...")
+// handle 调用handler处理一条消息，并记录正在处理的消息数
+// handler panic时只记录日志，消息由handler自行确认，需要自动拒绝时请使用ConsumeFunc
+func (c *Consumer) handle(delivery external.XDelivery, handler func(delivery external.XDelivery)) {
+	c.inflight.Add(1)
+	c.process(delivery, handler)
+}
+
+// process 调用handler处理一条已计入正在处理的消息数的消息
+func (c *Consumer) process(delivery external.XDelivery, handler func(delivery external.XDelivery)) {
+	defer func() {
+		if x := recover(); x != nil {
+			log.Logger.Errorf("%s: handle message %d panic: %+v", c.model, delivery.DeliveryTag, x)
+		}
+		c.inflight.Done()
+	}()
+	handler(delivery)
+}
+
+// Drain 停止接收新的消息，并等待正在被handler处理的消息处理完毕
+// ctx到期时返回被放弃的消息数
+func (c *Consumer) Drain(ctx context.Context) error {
+	c.session.Close()
+	if err := c.session.Channel().Cancel(c.tag, false); err != nil {
+		log.Logger.Warningf("%s drain: cancel subscription error: %s", c.model, err)
+	}
+	if err := c.inflight.Wait(ctx); err != nil {
+		return fmt.Errorf("%s abandoned %d in-flight deliveries: %w", c.model, c.inflight.Count(), err)
+	}
+	c.retrier.close()
+	return nil
 }
 
 func (c *Consumer) Cancel() error {
@@ -69,7 +199,8 @@ func (c *Consumer) Cancel() error {
 func (c *Consumer) releaseChannel() error {
 	var err error
 	c.cancelOnce.Do(func() {
-		err = utils.CancelChannel(c.session.Channel(), c.session.OptionsConsumer().Tag)
+		err = c.session.Release(c.tag)
+		c.retrier.close()
 	})
 	if err != nil {
 		return err
@@ -87,5 +218,9 @@ func (c *Consumer) Qos(messageCount int) error {
 	// prefetchCount：消费者未确认消息的个数。
 	// prefetchSize ：消费者未确认消息的大小。
 	// global ：是否全局生效，true表示是。全局生效指的是针对当前connect里的所有channel都生效。
-	return c.session.Channel().Qos(messageCount, 0, false)
+	if err := c.session.Channel().Qos(messageCount, 0, false); err != nil {
+		return err
+	}
+	c.prefetch = messageCount
+	return nil
 }
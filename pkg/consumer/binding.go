@@ -0,0 +1,156 @@
+package consumer
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+	"xrabbitmq/pkg/session/broker/binding"
+)
+
+// bindings 通过Bind/Unbind变更的绑定，会话恢复后重新声明时以此为准
+type bindings struct {
+	mu sync.Mutex
+
+	// bound 通过Bind添加的绑定
+	bound []binding.Binding
+
+	// unbound 通过Unbind解除的会话配置的绑定
+	unbound []binding.Binding
+}
+
+// indexOf 根据交换机、RoutingKey及Args查找绑定
+// headers交换机的绑定RoutingKey一般为空，只能通过Args区分
+func indexOf(list []binding.Binding, b binding.Binding) int {
+	for i := range list {
+		if list[i].Exchange == b.Exchange && list[i].RoutingKey == b.RoutingKey && sameArgs(list[i].Args, b.Args) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameArgs Args是否相同，nil与空表视为相同
+func sameArgs(a, b external.XTable) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// remove 移除list中与b相同的绑定
+func remove(list []binding.Binding, b binding.Binding) []binding.Binding {
+	if i := indexOf(list, b); i >= 0 {
+		return append(list[:i], list[i+1:]...)
+	}
+	return list
+}
+
+// DeclareBindings 将队列name绑定到会话配置的所有绑定，跳过已通过Unbind解除的绑定
+func (c *Consumer) DeclareBindings(channel *external.XChannel, name string) error {
+	c.bindings.mu.Lock()
+	unbound := append([]binding.Binding(nil), c.bindings.unbound...)
+	c.bindings.mu.Unlock()
+
+	for _, b := range c.session.Bindings() {
+		if indexOf(unbound, b) >= 0 {
+			continue
+		}
+		err := channel.QueueBind(
+			name,
+			b.RoutingKey,
+			b.Exchange,
+			b.NoWait,
+			b.Args,
+		)
+		if err != nil {
+			log.Logger.Errorf("%s.QueueBind %s to %s(%s) error: %s", c.model, name, b.Exchange, b.RoutingKey, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// declareBound 将队列name绑定到通过Bind添加的绑定
+func (c *Consumer) declareBound(channel *external.XChannel, name string) error {
+	c.bindings.mu.Lock()
+	defer c.bindings.mu.Unlock()
+	for _, b := range c.bindings.bound {
+		if err := channel.QueueBind(name, b.RoutingKey, b.Exchange, false, b.Args); err != nil {
+			log.Logger.Errorf("%s.QueueBind %s to %s(%s) error: %s", c.model, name, b.Exchange, b.RoutingKey, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// binding 得到exchange的key上以args建立的绑定，exchange为空时为会话的交换机
+func (c *Consumer) binding(key, exchange string, args external.XTable) binding.Binding {
+	if exchange == "" {
+		exchange = c.session.Exchange().Name
+	}
+	return binding.New(exchange, key, args)
+}
+
+// withChannel 在会话所在的连接上开辟临时的通信管道执行fn
+// 交换机不存在等错误会关闭通信管道，不能影响正在消费的通信管道
+func (c *Consumer) withChannel(fn func(channel *external.XChannel) error) error {
+	conn := c.session.Conn()
+	if conn == nil {
+		return fmt.Errorf("session not established")
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+	return fn(channel)
+}
+
+// Bind 将消费的队列以args绑定到exchange的key上，exchange为空时为会话的交换机
+// 尚未开始消费时只记录该绑定，在声明队列后生效；断线重连后会重新绑定
+func (c *Consumer) Bind(key, exchange string, args external.XTable) error {
+	b := c.binding(key, exchange, args)
+
+	c.bindings.mu.Lock()
+	defer c.bindings.mu.Unlock()
+
+	if name, _ := c.queue.Load().(string); name != "" {
+		err := c.withChannel(func(channel *external.XChannel) error {
+			return channel.QueueBind(name, b.RoutingKey, b.Exchange, false, b.Args)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: bind %s to %s(%s) error: %w", c.model, name, b.Exchange, b.RoutingKey, err)
+		}
+	}
+	c.bindings.unbound = remove(c.bindings.unbound, b)
+	if indexOf(c.bindings.bound, b) < 0 {
+		c.bindings.bound = append(c.bindings.bound, b)
+	}
+	return nil
+}
+
+// Unbind 解除消费的队列在exchange的key上以args建立的绑定，exchange为空时为会话的交换机
+// 交换机、key及args都相同才是同一个绑定；断线重连后不会再绑定
+func (c *Consumer) Unbind(key, exchange string, args external.XTable) error {
+	b := c.binding(key, exchange, args)
+	configured := c.session.Bindings()
+
+	c.bindings.mu.Lock()
+	defer c.bindings.mu.Unlock()
+
+	if name, _ := c.queue.Load().(string); name != "" {
+		err := c.withChannel(func(channel *external.XChannel) error {
+			return channel.QueueUnbind(name, b.RoutingKey, b.Exchange, b.Args)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: unbind %s from %s(%s) error: %w", c.model, name, b.Exchange, b.RoutingKey, err)
+		}
+	}
+	c.bindings.bound = remove(c.bindings.bound, b)
+	if indexOf(configured, b) >= 0 && indexOf(c.bindings.unbound, b) < 0 {
+		c.bindings.unbound = append(c.bindings.unbound, b)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package consumer
+
+import (
+	"reflect"
+	"testing"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+	"xrabbitmq/pkg/session/broker"
+	"xrabbitmq/pkg/session/broker/binding"
+	"xrabbitmq/pkg/session/broker/exchange"
+	"xrabbitmq/pkg/session/broker/queue"
+)
+
+func TestIndexOf(t *testing.T) {
+	tenantA := external.XTable{"x-match": "all", "tenant": "a"}
+	list := []binding.Binding{
+		binding.New("orders", "created", nil),
+		binding.New("tenants", "", tenantA),
+		binding.New("tenants", "", external.XTable{"x-match": "all", "tenant": "b"}),
+	}
+	cases := []struct {
+		name string
+		b    binding.Binding
+		want int
+	}{
+		{"same key", binding.New("orders", "created", nil), 0},
+		{"empty args same as nil", binding.New("orders", "created", external.XTable{}), 0},
+		{"other exchange", binding.New("events", "created", nil), -1},
+		{"other key", binding.New("orders", "deleted", nil), -1},
+		{"headers by args", binding.New("tenants", "", external.XTable{"x-match": "all", "tenant": "b"}), 2},
+		{"headers args differ", binding.New("tenants", "", external.XTable{"x-match": "any", "tenant": "a"}), -1},
+		{"headers without args", binding.New("tenants", "", nil), -1},
+	}
+	for _, c := range cases {
+		if got := indexOf(list, c.b); got != c.want {
+			t.Errorf("%s: indexOf = %d, want %d", c.name, got, c.want)
+		}
+		want := len(list)
+		if c.want >= 0 {
+			want--
+		}
+		removed := remove(append([]binding.Binding(nil), list...), c.b)
+		if len(removed) != want || indexOf(removed, c.b) >= 0 {
+			t.Errorf("%s: remove left %d bindings, want %d", c.name, len(removed), want)
+		}
+	}
+}
+
+func TestBindUnbindRecorded(t *testing.T) {
+	type op struct {
+		bind bool
+		key  string
+	}
+	cases := []struct {
+		name    string
+		ops     []op
+		bound   []string
+		unbound []string
+	}{
+		{"bind", []op{{true, "a"}}, []string{"a"}, nil},
+		{"bind twice", []op{{true, "a"}, {true, "a"}}, []string{"a"}, nil},
+		{"unbind bound", []op{{true, "a"}, {false, "a"}}, nil, nil},
+		{"unbind configured", []op{{false, "configured"}}, nil, []string{"configured"}},
+		{"unbind unknown", []op{{false, "b"}}, nil, nil},
+		{"rebind configured", []op{{false, "configured"}, {true, "configured"}}, []string{"configured"}, nil},
+	}
+	keys := func(list []binding.Binding) []string {
+		var keys []string
+		for _, b := range list {
+			keys = append(keys, b.RoutingKey)
+		}
+		return keys
+	}
+	for _, c := range cases {
+		consumer := NewConsumer(session.NewSession(session.WithBrokerOptions(
+			broker.WithExchange(exchange.SetName("orders"), exchange.SetType(external.XExchangeTopic)),
+			broker.WithQueue(queue.SetName("jobs")),
+			broker.WithBinding(binding.SetRoutingKey("configured")),
+		)), ModelTopic)
+		// 尚未开始消费时只记录绑定
+		for _, o := range c.ops {
+			var err error
+			if o.bind {
+				err = consumer.Bind(o.key, "", nil)
+			} else {
+				err = consumer.Unbind(o.key, "", nil)
+			}
+			if err != nil {
+				t.Fatalf("%s: %s", c.name, err)
+			}
+		}
+		if got := keys(consumer.bindings.bound); !reflect.DeepEqual(got, c.bound) {
+			t.Errorf("%s: bound %v, want %v", c.name, got, c.bound)
+		}
+		if got := keys(consumer.bindings.unbound); !reflect.DeepEqual(got, c.unbound) {
+			t.Errorf("%s: unbound %v, want %v", c.name, got, c.unbound)
+		}
+	}
+}
+
+func TestBindWithoutConnection(t *testing.T) {
+	consumer := NewConsumer(session.NewSession(session.WithBrokerOptions(
+		broker.WithExchange(exchange.SetName("orders"), exchange.SetType(external.XExchangeTopic)),
+	)), ModelTopic)
+	consumer.queue.Store("jobs")
+
+	// 正在消费时绑定失败不会被记录
+	if err := consumer.Bind("a", "", nil); err == nil {
+		t.Error("Bind without connection succeeded")
+	}
+	if len(consumer.bindings.bound) != 0 {
+		t.Errorf("failed Bind recorded: %v", consumer.bindings.bound)
+	}
+}
@@ -0,0 +1,36 @@
+package consumer
+
+import (
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+	"xrabbitmq/pkg/session/broker/queue"
+)
+
+// declareDeadLetter 配置了死信时，声明死信交换机及死信队列并绑定
+func (c *Consumer) declareDeadLetter(channel *external.XChannel) error {
+	dl, err := c.session.DeadLetter()
+	if err != nil || !dl.Enabled {
+		return err
+	}
+	if err := channel.ExchangeDeclare(dl.Exchange, external.XExchangeDirect, true, false, false, false, nil); err != nil {
+		log.Logger.Errorf("%s.ExchangeDeclare dead letter exchange error: %s", c.model, err)
+		return err
+	}
+	if _, err := channel.QueueDeclare(dl.Queue, true, false, false, false, nil); err != nil {
+		log.Logger.Errorf("%s.QueueDeclare dead letter queue error: %s", c.model, err)
+		return err
+	}
+	if err := channel.QueueBind(dl.Queue, dl.Queue, dl.Exchange, false, nil); err != nil {
+		log.Logger.Errorf("%s.QueueBind dead letter queue error: %s", c.model, err)
+		return err
+	}
+	return nil
+}
+
+// parking 得到队列name的死信队列，重试次数用尽的消息停放在这里
+func (c *Consumer) parking(name string) string {
+	if dl, err := c.session.DeadLetter(); err == nil && dl.Enabled {
+		return dl.Queue
+	}
+	return queue.DeadLetterName(name)
+}
@@ -0,0 +1,97 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+	"xrabbitmq/pkg/session/consumeropts"
+)
+
+// PanicError handler panic时得到的错误
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panic: %v", e.Value)
+}
+
+// ConsumeFunc 同Consume，handler返回nil时确认消息，返回错误或panic时按照消费者配置的策略拒绝消息
+// ctx在消费者关闭时被取消
+func (c *Consumer) ConsumeFunc(declare DeclareFunc, handler external.HandleFunc) error {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	return c.Consume(declare, func(delivery external.XDelivery) {
+		c.settle(delivery, c.invoke(ctx, delivery, handler))
+	})
+}
+
+// context 得到在消费者关闭时被取消的ctx
+func (c *Consumer) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-c.session.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// invoke 调用handler，handler panic时返回*PanicError
+func (c *Consumer) invoke(ctx context.Context, delivery external.XDelivery, handler external.HandleFunc) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = &PanicError{Value: x, Stack: debug.Stack()}
+			log.Logger.Errorf("%s: handle message %d panic: %+v\n%s", c.model, delivery.DeliveryTag, x, err.(*PanicError).Stack)
+		}
+	}()
+	return handler(ctx, delivery)
+}
+
+// settle 根据handler的处理结果确认或拒绝消息，自动确认时只记录错误
+func (c *Consumer) settle(delivery external.XDelivery, err error) {
+	consumerOptions := c.session.OptionsConsumer()
+	if consumerOptions.AutoAck {
+		if err != nil {
+			log.Logger.Errorf("%s: handle message %d error: %s", c.model, delivery.DeliveryTag, err)
+		}
+		return
+	}
+
+	var action consumeropts.Action
+	if _, ok := err.(*PanicError); ok {
+		action = consumerOptions.ActionForPanic()
+	} else {
+		action = consumerOptions.ActionFor(err)
+	}
+	if err != nil {
+		log.Logger.Errorf("%s: handle message %d error: %s, %s it", c.model, delivery.DeliveryTag, err, action)
+	}
+
+	// 开启了延迟重试时，需要重新入队的消息被发送到延迟队列
+	if action == consumeropts.ActionRequeue && c.retrying() {
+		if err := c.retry(delivery); err != nil {
+			log.Logger.Errorf("%s: retry message %d error: %s, requeue it", c.model, delivery.DeliveryTag, err)
+		} else {
+			action = consumeropts.ActionAck
+		}
+	}
+
+	switch action {
+	case consumeropts.ActionAck:
+		err = delivery.Ack(false)
+	case consumeropts.ActionReject:
+		err = delivery.Nack(false, false)
+	default:
+		err = delivery.Nack(false, true)
+	}
+	if err != nil {
+		log.Logger.Errorf("%s: %s message %d error: %s", c.model, action, delivery.DeliveryTag, err)
+	}
+}
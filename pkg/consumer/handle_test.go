@@ -0,0 +1,87 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+	"xrabbitmq/pkg/session/consumeropts"
+)
+
+// acknowledger 记录对消息的确认/拒绝
+type acknowledger struct {
+	settled []string
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.settled = append(a.settled, "ack")
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	if requeue {
+		a.settled = append(a.settled, "requeue")
+	} else {
+		a.settled = append(a.settled, "reject")
+	}
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func TestSettle(t *testing.T) {
+	errInvalid := errors.New("invalid")
+	cases := []struct {
+		name    string
+		opts    []consumeropts.Option
+		handler external.HandleFunc
+		want    []string
+	}{
+		{
+			name:    "acked on success",
+			handler: func(context.Context, external.XDelivery) error { return nil },
+			want:    []string{"ack"},
+		},
+		{
+			name:    "requeued on error",
+			handler: func(context.Context, external.XDelivery) error { return errInvalid },
+			want:    []string{"requeue"},
+		},
+		{
+			name:    "rejected by rule",
+			opts:    []consumeropts.Option{consumeropts.WithErrorRule(errInvalid, consumeropts.ActionReject)},
+			handler: func(context.Context, external.XDelivery) error { return errInvalid },
+			want:    []string{"reject"},
+		},
+		{
+			name:    "rejected on panic",
+			handler: func(context.Context, external.XDelivery) error { panic("boom") },
+			want:    []string{"reject"},
+		},
+		{
+			name:    "panic action",
+			opts:    []consumeropts.Option{consumeropts.SetPanicAction(consumeropts.ActionRequeue)},
+			handler: func(context.Context, external.XDelivery) error { panic("boom") },
+			want:    []string{"requeue"},
+		},
+		{
+			name:    "auto ack leaves message alone",
+			opts:    []consumeropts.Option{consumeropts.SetAutoAck(true)},
+			handler: func(context.Context, external.XDelivery) error { return errInvalid },
+		},
+	}
+	for _, c := range cases {
+		consumer := NewConsumer(session.NewSession(session.WithConsumerOptions(c.opts...)), ModelSimple)
+		ack := &acknowledger{}
+		delivery := external.XDelivery{Acknowledger: ack, DeliveryTag: 1}
+
+		consumer.settle(delivery, consumer.invoke(context.Background(), delivery, c.handler))
+		if !reflect.DeepEqual(ack.settled, c.want) {
+			t.Errorf("%s: settled %v, want %v", c.name, ack.settled, c.want)
+		}
+	}
+}
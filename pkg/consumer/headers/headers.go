@@ -0,0 +1,75 @@
+// Headers模式（头部模式，根据消息头的键值对而不是RoutingKey路由消息）
+// 1. 队列通过binding的Args绑定到headers交换机，Args中为要匹配的消息头键值对
+// 2. x-match为all时，消息头需要匹配所有的键值对；为any时，匹配任意一个即可
+// 3. 应用场景:按照租户、地域等多个属性路由消息
+
+package headers
+
+import (
+	"xrabbitmq/pkg/consumer"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+	"xrabbitmq/pkg/session"
+)
+
+type headers struct {
+	*consumer.Consumer
+}
+
+func New(sess *session.Session) *headers {
+	return &headers{consumer.NewConsumer(sess, consumer.ModelHeaders)}
+}
+
+func (c *headers) Consume(handler func(delivery external.XDelivery)) (err error) {
+	defer c.Done(err)
+	return c.Consumer.Consume(c.declare, handler)
+}
+
+func (c *headers) ConsumeFunc(handler external.HandleFunc) (err error) {
+	defer c.Done(err)
+	return c.Consumer.ConsumeFunc(c.declare, handler)
+}
+
+func (c *headers) ConsumeTyped(handler interface{}) (err error) {
+	defer c.Done(err)
+	return c.Consumer.ConsumeTyped(c.declare, handler)
+}
+
+// declare 声明交换机/队列/binding，返回要消费的队列名
+func (c *headers) declare(channel *external.XChannel) (string, error) {
+	queueOptions := c.Sess().Queue()
+	exchangeOptions := c.Sess().Exchange()
+
+	err := channel.ExchangeDeclare(
+		exchangeOptions.Name,
+		exchangeOptions.Typ,
+		exchangeOptions.Durable,
+		exchangeOptions.AutoDelete,
+		exchangeOptions.Internal,
+		exchangeOptions.NoWait,
+		exchangeOptions.Args,
+	)
+	if err != nil {
+		log.Logger.Errorf("%s.ExchangeDeclare error: %s", c.Model(), err)
+		return "", err
+	}
+
+	q, err := channel.QueueDeclare(
+		queueOptions.Name, // 随机生产队列名称,这里注意队列名称不要写
+		queueOptions.Durable,
+		queueOptions.AutoDelete,
+		queueOptions.Exclusive,
+		queueOptions.NoWait,
+		queueOptions.Args,
+	)
+	if err != nil {
+		log.Logger.Errorf("%s.QueueDeclare error: %s", c.Model(), err)
+		return "", err
+	}
+
+	if err = c.DeclareBindings(channel, q.Name); err != nil {
+		return "", err
+	}
+
+	return q.Name, nil
+}
@@ -8,6 +8,7 @@ const (
 	ModelPublish
 	ModelRouting
 	ModelTopic
+	ModelHeaders
 )
 
 func (m Model) String() string {
@@ -22,6 +23,8 @@ func (m Model) String() string {
 		return "routing model consumer"
 	case ModelTopic:
 		return "topic model consumer"
+	case ModelHeaders:
+		return "headers model consumer"
 	default:
 		return "unknown model consumer"
 	}
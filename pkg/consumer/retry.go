@@ -0,0 +1,152 @@
+package consumer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+	"xrabbitmq/pkg/pool"
+	"xrabbitmq/pkg/session/broker/queue"
+)
+
+const (
+	// RetryAttemptHeader 记录消息已重试次数的消息头
+	RetryAttemptHeader = "x-retry-attempt"
+
+	// OriginQueueHeader 记录被停放的消息原本所在的队列，重试次数用尽的消息没有x-death消息头
+	OriginQueueHeader = "x-origin-queue"
+)
+
+// retrying 是否开启了延迟重试
+func (c *Consumer) retrying() bool {
+	return len(c.session.OptionsConsumer().RetryDelays) > 0
+}
+
+// declareRetry 为队列name声明各级延迟队列及死信队列
+// 延迟队列中的消息过期后，经默认交换机回到原队列
+func (c *Consumer) declareRetry(channel *external.XChannel, name string) error {
+	durable := c.session.Queue().Durable
+	for _, delay := range c.session.OptionsConsumer().RetryDelays {
+		_, err := channel.QueueDeclare(queue.RetryName(name, delay), durable, false, false, false, external.XTable{
+			"x-message-ttl":             int64(delay / time.Millisecond),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": name,
+		})
+		if err != nil {
+			log.Logger.Errorf("%s.QueueDeclare retry queue error: %s", c.model, err)
+			return err
+		}
+	}
+	if dl, _ := c.session.DeadLetter(); dl.Enabled {
+		// 死信队列已由declareDeadLetter声明
+		return nil
+	}
+	if _, err := channel.QueueDeclare(queue.DeadLetterName(name), durable, false, false, false, nil); err != nil {
+		log.Logger.Errorf("%s.QueueDeclare dead letter queue error: %s", c.model, err)
+		return err
+	}
+	return nil
+}
+
+// retrier 延迟重试专用的通信管道，与消费的通信管道分开：
+// 重试消息被阻塞或拒绝时不会影响消息的接收，通信管道异常关闭也不会取消订阅
+type retrier struct {
+	mu sync.Mutex
+
+	channel *pool.Channel
+}
+
+// get 得到可用的重试通信管道，第一次使用或已关闭时在会话所在的连接上重新开辟并开启消息确认
+func (r *retrier) get(conn *external.XConnection) (*pool.Channel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.channel != nil && !r.channel.Closed() {
+		return r.channel, nil
+	}
+	if conn == nil || conn.IsClosed() {
+		return nil, pool.ErrChannelClosed
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	confirming, err := pool.Wrap(conn, channel)
+	if err != nil {
+		_ = channel.Close()
+		return nil, fmt.Errorf("publisher confirms not supported: %w", err)
+	}
+	r.channel = confirming
+	return confirming, nil
+}
+
+// close 关闭重试通信管道，消费者释放时调用
+func (r *retrier) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.channel != nil {
+		r.channel.Close()
+		r.channel = nil
+	}
+}
+
+// retry 将消息发送到下一级延迟队列，重试次数用尽时停放到死信队列
+// 阻塞直到broker确认，只有返回nil时原消息才可以被确认
+func (c *Consumer) retry(delivery external.XDelivery) error {
+	name, _ := c.queue.Load().(string)
+	if name == "" {
+		return fmt.Errorf("%s: retry error: queue not declared", c.model)
+	}
+	republisher, err := c.retrier.get(c.session.Conn())
+	if err != nil {
+		return fmt.Errorf("%s: retry error: %w", c.model, err)
+	}
+
+	msg := external.Republishing(delivery)
+	attempt := retryAttempt(delivery) + 1
+	msg.Headers[RetryAttemptHeader] = int64(attempt)
+
+	target, parked := c.retryTarget(name, attempt)
+	if parked {
+		log.Logger.Warningf("%s: message %d exceeded %d retries, park it in %s", c.model, delivery.DeliveryTag, attempt-1, target)
+		msg.Headers[OriginQueueHeader] = name
+	}
+
+	// 经默认交换机直接发送到目标队列，目标队列不存在时消息会被退回
+	if err := republisher.PublishWait("", target, msg); err != nil {
+		return fmt.Errorf("%s: retry to %s error: %w", c.model, target, err)
+	}
+	return nil
+}
+
+// retryTarget 得到队列name中第attempt次重试的消息要发送到的队列
+// 第n次重试发送到等待RetryDelays[n-1]的延迟队列(超过长度时使用最后一个)，重试次数用尽时parked为true，发送到死信队列
+func (c *Consumer) retryTarget(name string, attempt int) (target string, parked bool) {
+	consumerOptions := c.session.OptionsConsumer()
+	delays := consumerOptions.RetryDelays
+	maxAttempts := consumerOptions.RetryMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = len(delays)
+	}
+	if attempt > maxAttempts {
+		return c.parking(name), true
+	}
+	delay := delays[len(delays)-1]
+	if attempt <= len(delays) {
+		delay = delays[attempt-1]
+	}
+	return queue.RetryName(name, delay), false
+}
+
+// retryAttempt 得到消息已重试的次数
+func retryAttempt(delivery external.XDelivery) int {
+	switch n := delivery.Headers[RetryAttemptHeader].(type) {
+	case int64:
+		return int(n)
+	case int32:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package consumer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+	"xrabbitmq/pkg/session/broker"
+	"xrabbitmq/pkg/session/broker/queue"
+	"xrabbitmq/pkg/session/consumeropts"
+)
+
+func TestRetryAttempt(t *testing.T) {
+	cases := []struct {
+		name    string
+		headers external.XTable
+		want    int
+	}{
+		{"no headers", nil, 0},
+		{"int64", external.XTable{RetryAttemptHeader: int64(3)}, 3},
+		{"int32", external.XTable{RetryAttemptHeader: int32(2)}, 2},
+		{"int", external.XTable{RetryAttemptHeader: 1}, 1},
+		{"unexpected type", external.XTable{RetryAttemptHeader: "2"}, 0},
+	}
+	for _, c := range cases {
+		if got := retryAttempt(external.XDelivery{Headers: c.headers}); got != c.want {
+			t.Errorf("%s: retryAttempt = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRetryTarget(t *testing.T) {
+	cases := []struct {
+		name    string
+		opts    []broker.Option
+		retry   consumeropts.Option
+		attempt int
+		target  string
+		parked  bool
+	}{
+		{"first delay", nil, consumeropts.WithRetry(0, time.Second, time.Minute), 1, queue.RetryName("jobs", time.Second), false},
+		{"second delay", nil, consumeropts.WithRetry(0, time.Second, time.Minute), 2, queue.RetryName("jobs", time.Minute), false},
+		{"exhausted", nil, consumeropts.WithRetry(0, time.Second, time.Minute), 3, queue.DeadLetterName("jobs"), true},
+		{"last delay repeated", nil, consumeropts.WithRetry(4, time.Second, time.Minute), 4, queue.RetryName("jobs", time.Minute), false},
+		{"fewer attempts than delays", nil, consumeropts.WithRetry(1, time.Second, time.Minute), 2, queue.DeadLetterName("jobs"), true},
+		{"configured dead letter queue", []broker.Option{broker.WithDeadLetter("dlx", "parking")}, consumeropts.WithRetry(1, time.Second), 2, "parking", true},
+	}
+	for _, c := range cases {
+		opts := append([]broker.Option{broker.WithQueue(queue.SetName("jobs"))}, c.opts...)
+		consumer := NewConsumer(session.NewSession(
+			session.WithBrokerOptions(opts...),
+			session.WithConsumerOptions(c.retry),
+		), ModelSimple)
+		target, parked := consumer.retryTarget("jobs", c.attempt)
+		if target != c.target || parked != c.parked {
+			t.Errorf("%s: retryTarget(%d) = %q, %v, want %q, %v", c.name, c.attempt, target, parked, c.target, c.parked)
+		}
+	}
+}
+
+func TestRetryUnavailableRequeues(t *testing.T) {
+	cases := []struct {
+		name  string
+		queue string
+	}{
+		{"queue not declared", ""},
+		{"connection down", "jobs"},
+	}
+	for _, c := range cases {
+		consumer := NewConsumer(session.NewSession(
+			session.WithBrokerOptions(broker.WithQueue(queue.SetName("jobs"))),
+			session.WithConsumerOptions(consumeropts.WithRetry(0, time.Second)),
+		), ModelSimple)
+		consumer.queue.Store(c.queue)
+		ack := &acknowledger{}
+
+		// 重试消息发送失败时原消息重新入队，不会丢失
+		consumer.settle(external.XDelivery{Acknowledger: ack, DeliveryTag: 1}, errors.New("temporary"))
+		if want := []string{"requeue"}; !reflect.DeepEqual(ack.settled, want) {
+			t.Errorf("%s: settled %v, want %v", c.name, ack.settled, want)
+		}
+	}
+}
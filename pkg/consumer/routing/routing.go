@@ -28,13 +28,25 @@ func New(sess *session.Session) *routing {
 
 func (c *routing) Consume(handler func(delivery external.XDelivery)) (err error) {
 	defer c.Done(err)
+	return c.Consumer.Consume(c.declare, handler)
+}
+
+func (c *routing) ConsumeFunc(handler external.HandleFunc) (err error) {
+	defer c.Done(err)
+	return c.Consumer.ConsumeFunc(c.declare, handler)
+}
+
+func (c *routing) ConsumeTyped(handler interface{}) (err error) {
+	defer c.Done(err)
+	return c.Consumer.ConsumeTyped(c.declare, handler)
+}
 
+// declare 声明交换机/队列/binding，返回要消费的队列名
+func (c *routing) declare(channel *external.XChannel) (string, error) {
 	queueOptions := c.Sess().Queue()
-	consumerOptions := c.Sess().OptionsConsumer()
 	exchangeOptions := c.Sess().Exchange()
-	BindingOptions := c.Sess().Binding()
 
-	err = c.Sess().Channel().ExchangeDeclare(
+	err := channel.ExchangeDeclare(
 		exchangeOptions.Name,
 		exchangeOptions.Typ,
 		exchangeOptions.Durable,
@@ -45,10 +57,10 @@ func (c *routing) Consume(handler func(delivery external.XDelivery)) (err error)
 	)
 	if err != nil {
 		log.Logger.Errorf("%s.ExchangeDeclare error: %s", c.Model(), err)
-		return err
+		return "", err
 	}
 
-	q, err := c.Sess().Channel().QueueDeclare(
+	q, err := channel.QueueDeclare(
 		queueOptions.Name, // 随机生产队列名称,这里注意队列名称不要写
 		queueOptions.Durable,
 		queueOptions.AutoDelete,
@@ -58,35 +70,12 @@ func (c *routing) Consume(handler func(delivery external.XDelivery)) (err error)
 	)
 	if err != nil {
 		log.Logger.Errorf("%s.QueueDeclare error: %s", c.Model(), err)
-		return err
+		return "", err
 	}
 
-	err = c.Sess().Channel().QueueBind(
-		q.Name,
-		BindingOptions.RoutingKey,
-		exchangeOptions.Name,
-		BindingOptions.NoWait,
-		BindingOptions.Args,
-	)
-	if err != nil {
-		log.Logger.Errorf("%s.QueueBind error: %s", c.Model(), err)
-		return err
-	}
-
-	deliveries, err := c.Sess().Channel().Consume(
-		q.Name,
-		consumerOptions.Tag,
-		consumerOptions.AutoAck,
-		consumerOptions.NoLocal,
-		consumerOptions.Exclusive,
-		consumerOptions.NoWait,
-		consumerOptions.Args,
-	)
-	if err != nil {
-		log.Logger.Errorf("%s.Consume error: %s.", c.Model(), err)
-		return err
+	if err = c.DeclareBindings(channel, q.Name); err != nil {
+		return "", err
 	}
 
-	c.Consumer.Consume(deliveries, handler)
-	return nil
+	return q.Name, nil
 }
@@ -26,10 +26,23 @@ func New(sess *session.Session) *simple {
 // 开始消费
 func (c *simple) Consume(handler func(delivery external.XDelivery)) (err error) {
 	defer c.Done(err)
+	return c.Consumer.Consume(c.declare, handler)
+}
+
+func (c *simple) ConsumeFunc(handler external.HandleFunc) (err error) {
+	defer c.Done(err)
+	return c.Consumer.ConsumeFunc(c.declare, handler)
+}
+
+func (c *simple) ConsumeTyped(handler interface{}) (err error) {
+	defer c.Done(err)
+	return c.Consumer.ConsumeTyped(c.declare, handler)
+}
 
+// declare 声明队列，返回要消费的队列名
+func (c *simple) declare(channel *external.XChannel) (string, error) {
 	queueOptions := c.Sess().Queue()
-	consumerOptions := c.Sess().OptionsConsumer()
-	q, err := c.Sess().Channel().QueueDeclare(
+	q, err := channel.QueueDeclare(
 		queueOptions.Name,
 		queueOptions.Durable,
 		queueOptions.AutoDelete,
@@ -39,24 +52,8 @@ func (c *simple) Consume(handler func(delivery external.XDelivery)) (err error)
 	)
 	if err != nil {
 		log.Logger.Errorf("%s.QueueDeclare error: %s.", c.Model(), err)
-		return err
-	}
-
-	deliveries, err := c.Sess().Channel().Consume(
-		q.Name,
-		consumerOptions.Tag,
-		consumerOptions.AutoAck,
-		consumerOptions.NoLocal,
-		consumerOptions.Exclusive,
-		consumerOptions.NoWait,
-		consumerOptions.Args,
-	)
-
-	if err != nil {
-		log.Logger.Errorf("%s.Consume error: %s.", c.Model(), err)
-		return err
+		return "", err
 	}
 
-	c.Consumer.Consume(deliveries, handler)
-	return nil
+	return q.Name, nil
 }
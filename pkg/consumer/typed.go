@@ -0,0 +1,102 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"xrabbitmq/pkg/codec"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	metaType    = reflect.TypeOf(external.Meta{})
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// typedHandler 通过反射调用形如func(ctx context.Context, msg *T, meta external.Meta) error的handler
+type typedHandler struct {
+	fn reflect.Value
+
+	// msgType 消息体解码的目标类型T
+	msgType reflect.Type
+}
+
+// newTypedHandler 校验handler的签名
+func newTypedHandler(handler interface{}) (*typedHandler, error) {
+	fn := reflect.ValueOf(handler)
+	if !fn.IsValid() || fn.Kind() != reflect.Func || fn.IsNil() {
+		return nil, fmt.Errorf("consumer: handler must be func(context.Context, *T, external.Meta) error, got %T", handler)
+	}
+	t := fn.Type()
+	if t.NumIn() != 3 || t.NumOut() != 1 ||
+		t.In(0) != contextType ||
+		t.In(1).Kind() != reflect.Ptr ||
+		t.In(2) != metaType ||
+		t.Out(0) != errorType {
+		return nil, fmt.Errorf("consumer: handler must be func(context.Context, *T, external.Meta) error, got %s", t)
+	}
+	return &typedHandler{fn: fn, msgType: t.In(1).Elem()}, nil
+}
+
+// decode 根据消息的ContentType选择解码器，将消息体解码为*T
+func (h *typedHandler) decode(delivery external.XDelivery) (reflect.Value, error) {
+	c, err := codec.ForContentType(delivery.ContentType)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	msg := reflect.New(h.msgType)
+	if err := c.Unmarshal(delivery.Body, msg.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("unmarshal %s error: %w", msg.Type(), err)
+	}
+	return msg, nil
+}
+
+func (h *typedHandler) call(ctx context.Context, msg reflect.Value, meta external.Meta) error {
+	out := h.fn.Call([]reflect.Value{reflect.ValueOf(ctx), msg, reflect.ValueOf(meta)})
+	if err, ok := out[0].Interface().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// ConsumeTyped 同Consume，消息体被解码后交给handler处理，handler形如
+// func(ctx context.Context, msg *OrderCreated, meta external.Meta) error
+// 确认消息的方式同ConsumeFunc；解码失败的消息交给PoisonHandler处理
+func (c *Consumer) ConsumeTyped(declare DeclareFunc, handler interface{}) error {
+	h, err := newTypedHandler(handler)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	return c.Consume(declare, func(delivery external.XDelivery) {
+		msg, err := h.decode(delivery)
+		if err != nil {
+			c.poison(delivery, err)
+			return
+		}
+		c.settle(delivery, c.invoke(ctx, delivery, func(ctx context.Context, delivery external.XDelivery) error {
+			return h.call(ctx, msg, external.NewMeta(delivery))
+		}))
+	})
+}
+
+// poison 处理无法解码的消息，未设置PoisonHandler时拒绝该消息且不重新入队
+func (c *Consumer) poison(delivery external.XDelivery, err error) {
+	log.Logger.Errorf("%s: poison message %d: %s", c.model, delivery.DeliveryTag, err)
+	consumerOptions := c.session.OptionsConsumer()
+	if consumerOptions.PoisonHandler != nil {
+		consumerOptions.PoisonHandler(delivery, err)
+		return
+	}
+	if consumerOptions.AutoAck {
+		return
+	}
+	if err := delivery.Reject(false); err != nil {
+		log.Logger.Errorf("%s: reject message %d error: %s", c.model, delivery.DeliveryTag, err)
+	}
+}
@@ -0,0 +1,39 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"xrabbitmq/pkg/external"
+)
+
+type order struct {
+	ID int `json:"id"`
+}
+
+func TestNewTypedHandler(t *testing.T) {
+	var nilFunc func(context.Context, *order, external.Meta) error
+	cases := []struct {
+		name    string
+		handler interface{}
+		ok      bool
+	}{
+		{"valid", func(context.Context, *order, external.Meta) error { return nil }, true},
+		{"nil", nil, false},
+		{"nil func", nilFunc, false},
+		{"not a func", order{}, false},
+		{"message not a pointer", func(context.Context, order, external.Meta) error { return nil }, false},
+		{"missing meta", func(context.Context, *order) error { return nil }, false},
+		{"no error result", func(context.Context, *order, external.Meta) {}, false},
+		{"context not first", func(*order, context.Context, external.Meta) error { return nil }, false},
+	}
+	for _, c := range cases {
+		h, err := newTypedHandler(c.handler)
+		if ok := err == nil; ok != c.ok {
+			t.Errorf("%s: newTypedHandler error = %v, want ok = %v", c.name, err, c.ok)
+			continue
+		}
+		if c.ok && h.msgType.Name() != "order" {
+			t.Errorf("%s: msgType = %s, want order", c.name, h.msgType)
+		}
+	}
+}
@@ -28,10 +28,23 @@ func New(sess *session.Session) *work {
 // 开始消费
 func (c *work) Consume(handler func(delivery external.XDelivery)) (err error) {
 	defer c.Done(err)
+	return c.Consumer.Consume(c.declare, handler)
+}
+
+func (c *work) ConsumeFunc(handler external.HandleFunc) (err error) {
+	defer c.Done(err)
+	return c.Consumer.ConsumeFunc(c.declare, handler)
+}
 
+func (c *work) ConsumeTyped(handler interface{}) (err error) {
+	defer c.Done(err)
+	return c.Consumer.ConsumeTyped(c.declare, handler)
+}
+
+// declare 声明队列，返回要消费的队列名
+func (c *work) declare(channel *external.XChannel) (string, error) {
 	queueOptions := c.Sess().Queue()
-	consumerOptions := c.Sess().OptionsConsumer()
-	q, err := c.Sess().Channel().QueueDeclare(
+	q, err := channel.QueueDeclare(
 		queueOptions.Name,
 		queueOptions.Durable,
 		queueOptions.AutoDelete,
@@ -41,23 +54,8 @@ func (c *work) Consume(handler func(delivery external.XDelivery)) (err error) {
 	)
 	if err != nil {
 		log.Logger.Errorf("%s.QueueDeclare error: %s.", c.Model(), err)
-		return err
-	}
-
-	deliveries, err := c.Sess().Channel().Consume(
-		q.Name,
-		consumerOptions.Tag,
-		consumerOptions.AutoAck,
-		consumerOptions.NoLocal,
-		consumerOptions.Exclusive,
-		consumerOptions.NoWait,
-		consumerOptions.Args,
-	)
-	if err != nil {
-		log.Logger.Errorf("%s.Consume error: %s.", c.Model(), err)
-		return err
+		return "", err
 	}
 
-	c.Consumer.Consume(deliveries, handler)
-	return nil
+	return q.Name, nil
 }
@@ -0,0 +1,57 @@
+package consumer
+
+import (
+	"hash/fnv"
+	"sync"
+	"xrabbitmq/pkg/external"
+)
+
+// workers 根据Concurrency启动处理消息的goroutine
+// dispatch将消息分发给它们，stop在所有已分发的消息处理完毕后返回
+func (c *Consumer) workers(handler func(delivery external.XDelivery)) (dispatch func(delivery external.XDelivery), stop func()) {
+	consumerOptions := c.session.OptionsConsumer()
+	n := consumerOptions.Concurrency
+	if n <= 1 {
+		return func(delivery external.XDelivery) {
+			c.handle(delivery, handler)
+		}, func() {}
+	}
+
+	// 需要保持顺序时每个goroutine有自己的队列，否则共享一个队列
+	queues := make([]chan external.XDelivery, 1)
+	if consumerOptions.OrderingKey != nil {
+		queues = make([]chan external.XDelivery, n)
+	}
+	for i := range queues {
+		queues[i] = make(chan external.XDelivery)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(queue <-chan external.XDelivery) {
+			defer wg.Done()
+			for delivery := range queue {
+				c.process(delivery, handler)
+			}
+		}(queues[i%len(queues)])
+	}
+
+	dispatch = func(delivery external.XDelivery) {
+		c.inflight.Add(1)
+		queue := queues[0]
+		if consumerOptions.OrderingKey != nil {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(consumerOptions.OrderingKey(delivery)))
+			queue = queues[h.Sum32()%uint32(n)]
+		}
+		queue <- delivery
+	}
+	stop = func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}
+	return dispatch, stop
+}
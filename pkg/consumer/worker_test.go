@@ -0,0 +1,92 @@
+package consumer
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+	"xrabbitmq/pkg/session/consumeropts"
+)
+
+func TestWorkersOrdering(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []consumeropts.Option
+		// ordered 同一个RoutingKey的消息是否保持接收顺序
+		ordered bool
+		// parallel 是否同时处理多条消息
+		parallel bool
+	}{
+		{"sequential", nil, true, false},
+		{"concurrent", []consumeropts.Option{consumeropts.SetConcurrency(4)}, false, true},
+		{"concurrent ordered by routing key", []consumeropts.Option{consumeropts.SetConcurrency(4), consumeropts.OrderByRoutingKey()}, true, true},
+	}
+	for _, c := range cases {
+		consumer := NewConsumer(session.NewSession(session.WithConsumerOptions(c.opts...)), ModelSimple)
+
+		var (
+			mu      sync.Mutex
+			handled = make(map[string][]uint64)
+			running int
+			peak    int
+		)
+		dispatch, stop := consumer.workers(func(delivery external.XDelivery) {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+
+			mu.Lock()
+			running--
+			handled[delivery.RoutingKey] = append(handled[delivery.RoutingKey], delivery.DeliveryTag)
+			mu.Unlock()
+		})
+		for tag := uint64(1); tag <= 200; tag++ {
+			dispatch(external.XDelivery{DeliveryTag: tag, RoutingKey: fmt.Sprintf("key-%d", tag%5)})
+		}
+		stop()
+
+		total := 0
+		for key, tags := range handled {
+			total += len(tags)
+			if !c.ordered {
+				continue
+			}
+			for i := 1; i < len(tags); i++ {
+				if tags[i] < tags[i-1] {
+					t.Errorf("%s: %s handled out of order: %v", c.name, key, tags)
+					break
+				}
+			}
+		}
+		if total != 200 {
+			t.Errorf("%s: handled %d deliveries, want 200", c.name, total)
+		}
+		if got := peak > 1; got != c.parallel {
+			t.Errorf("%s: at most %d deliveries handled at once, want parallel = %v", c.name, peak, c.parallel)
+		}
+		if n := consumer.inflight.Count(); n != 0 {
+			t.Errorf("%s: %d deliveries still in flight after stop", c.name, n)
+		}
+	}
+}
+
+func TestWorkersRecoverPanic(t *testing.T) {
+	consumer := NewConsumer(session.NewSession(session.WithConsumerOptions(consumeropts.SetConcurrency(2))), ModelSimple)
+	dispatch, stop := consumer.workers(func(delivery external.XDelivery) {
+		panic("boom")
+	})
+	dispatch(external.XDelivery{DeliveryTag: 1})
+	dispatch(external.XDelivery{DeliveryTag: 2})
+	stop()
+	if n := consumer.inflight.Count(); n != 0 {
+		t.Errorf("%d deliveries still in flight after handler panic", n)
+	}
+}
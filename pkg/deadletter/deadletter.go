@@ -0,0 +1,166 @@
+// 死信队列的查看、重新投递及清空
+// 死信队列中的消息来自队列配置的死信交换机(带有x-death消息头)，或延迟重试次数用尽后被停放(带有x-origin-queue消息头)
+package deadletter
+
+import (
+	"fmt"
+	"time"
+	"xrabbitmq/pkg/consumer"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/pool"
+)
+
+// Message 死信队列中的一条消息
+type Message struct {
+	external.XDelivery
+
+	// Origin 消息原本所在的队列
+	Origin string
+
+	// Reason 成为死信的原因：rejected/expired/maxlen，重试次数用尽被停放时为"retries-exhausted"
+	Reason string
+
+	// Count 在原本所在的队列中成为死信的次数
+	Count int64
+
+	// Time 最近一次成为死信的时间
+	Time time.Time
+}
+
+// newMessage 根据x-origin-queue或x-death消息头得到消息的来源
+// 重试次数用尽被停放的消息也带有延迟队列过期留下的x-death，所以先检查x-origin-queue
+func newMessage(delivery external.XDelivery) Message {
+	m := Message{XDelivery: delivery}
+	if origin, ok := delivery.Headers[consumer.OriginQueueHeader].(string); ok && origin != "" {
+		m.Origin, m.Reason = origin, "retries-exhausted"
+		m.Time = delivery.Timestamp
+		return m
+	}
+	if deaths, ok := delivery.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		// x-death中最近的记录在最前面
+		if death, ok := deaths[0].(external.XTable); ok {
+			m.Origin, _ = death["queue"].(string)
+			m.Reason, _ = death["reason"].(string)
+			m.Count, _ = death["count"].(int64)
+			m.Time, _ = death["time"].(time.Time)
+		}
+	}
+	return m
+}
+
+// Inspect 查看死信队列中最多limit条消息，消息仍然保留在死信队列中
+// 在连接上开辟专用的通信管道，用完即关闭，取出的消息逐条放回死信队列
+func Inspect(conn *external.XConnection, queue string, limit int) ([]Message, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("deadletter inspect %s error: %w", queue, err)
+	}
+	// 出错时还未放回的消息随通信管道关闭回到死信队列
+	defer channel.Close()
+
+	deliveries, err := get(channel, queue, limit)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, len(deliveries))
+	for _, d := range deliveries {
+		// 逐条放回死信队列
+		if err := d.Nack(false, true); err != nil {
+			return nil, fmt.Errorf("deadletter inspect %s error: %w", queue, err)
+		}
+		messages = append(messages, newMessage(d))
+	}
+	return messages, nil
+}
+
+// Requeue 将死信队列中最多limit条消息重新投递到它们原本所在的队列，limit不大于0时为当前所有的消息
+// 在连接上开辟专用的通信管道并开启消息确认，重新投递的消息被broker确认后才从死信队列中移除；
+// 重新投递的消息会清除重试次数；无法得知来源的消息保留在死信队列中。返回重新投递的消息数
+func Requeue(conn *external.XConnection, queue string, limit int) (int, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("deadletter requeue %s error: %w", queue, err)
+	}
+	// 出错时还未确认的消息随通信管道关闭回到死信队列
+	defer channel.Close()
+	republisher, err := pool.Wrap(conn, channel)
+	if err != nil {
+		return 0, fmt.Errorf("deadletter requeue %s error: %w", queue, err)
+	}
+
+	deliveries, err := get(channel, queue, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		requeued int
+		unknown  []external.XDelivery
+	)
+	// 无法得知来源的消息在最后放回死信队列，避免被再次取出
+	defer func() {
+		for _, d := range unknown {
+			_ = d.Nack(false, true)
+		}
+	}()
+	for _, d := range deliveries {
+		m := newMessage(d)
+		if m.Origin == "" || m.Origin == queue {
+			unknown = append(unknown, d)
+			continue
+		}
+
+		msg := external.Republishing(d)
+		delete(msg.Headers, consumer.RetryAttemptHeader)
+		delete(msg.Headers, consumer.OriginQueueHeader)
+		// 经默认交换机直接发送到原本所在的队列，并等待broker确认
+		if err := republisher.PublishWait("", m.Origin, msg); err != nil {
+			return requeued, fmt.Errorf("deadletter requeue %s to %s error: %w", queue, m.Origin, err)
+		}
+		if err := d.Ack(false); err != nil {
+			return requeued, fmt.Errorf("deadletter requeue %s error: %w", queue, err)
+		}
+		requeued++
+	}
+	return requeued, nil
+}
+
+// Purge 清空死信队列，返回被清除的消息数
+// 在连接上开辟专用的通信管道，队列不存在等channel级别的错误不会影响连接上的其它通信管道
+func Purge(conn *external.XConnection, queue string) (int, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("deadletter purge %s error: %w", queue, err)
+	}
+	defer channel.Close()
+
+	n, err := channel.QueuePurge(queue, false)
+	if err != nil {
+		return 0, fmt.Errorf("deadletter purge %s error: %w", queue, err)
+	}
+	return n, nil
+}
+
+// get 从队列中取出最多limit条未确认的消息，limit不大于0时为当前所有的消息
+func get(channel *external.XChannel, queue string, limit int) ([]external.XDelivery, error) {
+	q, err := channel.QueueInspect(queue)
+	if err != nil {
+		return nil, fmt.Errorf("deadletter inspect %s error: %w", queue, err)
+	}
+	if limit <= 0 || limit > q.Messages {
+		limit = q.Messages
+	}
+
+	deliveries := make([]external.XDelivery, 0, limit)
+	for len(deliveries) < limit {
+		d, ok, err := channel.Get(queue, false)
+		if err != nil {
+			return nil, fmt.Errorf("deadletter get %s error: %w", queue, err)
+		}
+		if !ok {
+			break
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,61 @@
+package deadletter
+
+import (
+	"testing"
+	"time"
+	"xrabbitmq/pkg/consumer"
+	"xrabbitmq/pkg/external"
+)
+
+func TestNewMessage(t *testing.T) {
+	died := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	parked := died.Add(time.Minute)
+	// 延迟队列过期留下的x-death
+	expired := external.XTable{"queue": "jobs.retry.1s", "reason": "expired", "count": int64(3), "time": died}
+
+	cases := []struct {
+		name    string
+		headers external.XTable
+		want    Message
+	}{
+		{
+			name:    "rejected",
+			headers: external.XTable{"x-death": []interface{}{external.XTable{"queue": "jobs", "reason": "rejected", "count": int64(1), "time": died}}},
+			want:    Message{Origin: "jobs", Reason: "rejected", Count: 1, Time: died},
+		},
+		{
+			name: "latest death first",
+			headers: external.XTable{"x-death": []interface{}{
+				external.XTable{"queue": "jobs", "reason": "maxlen", "count": int64(2), "time": died},
+				external.XTable{"queue": "other", "reason": "rejected", "count": int64(1)},
+			}},
+			want: Message{Origin: "jobs", Reason: "maxlen", Count: 2, Time: died},
+		},
+		{
+			name:    "retries exhausted",
+			headers: external.XTable{consumer.OriginQueueHeader: "jobs", "x-death": []interface{}{expired}},
+			want:    Message{Origin: "jobs", Reason: "retries-exhausted", Time: parked},
+		},
+		{
+			name:    "empty origin falls back to x-death",
+			headers: external.XTable{consumer.OriginQueueHeader: "", "x-death": []interface{}{expired}},
+			want:    Message{Origin: "jobs.retry.1s", Reason: "expired", Count: 3, Time: died},
+		},
+		{
+			name: "unknown source",
+			want: Message{},
+		},
+		{
+			name:    "malformed x-death",
+			headers: external.XTable{"x-death": []interface{}{"jobs"}},
+			want:    Message{},
+		},
+	}
+	for _, c := range cases {
+		got := newMessage(external.XDelivery{Headers: c.headers, Timestamp: parked})
+		if got.Origin != c.want.Origin || got.Reason != c.want.Reason || got.Count != c.want.Count || !got.Time.Equal(c.want.Time) {
+			t.Errorf("%s: newMessage = {%q %q %d %s}, want {%q %q %d %s}", c.name,
+				got.Origin, got.Reason, got.Count, got.Time, c.want.Origin, c.want.Reason, c.want.Count, c.want.Time)
+		}
+	}
+}
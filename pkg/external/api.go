@@ -1,6 +1,11 @@
 // Expose the interface for external band calls
 package external
 
+import (
+	"context"
+	"time"
+)
+
 // 生产者
 type Producer interface {
 	// NotifyReturn
@@ -11,10 +16,31 @@ type Producer interface {
 	// Publish 生产一条消息
 	Publish(messages <-chan *XPublishMsg) error
 
+	// PublishWithConfirm 发送一条消息，返回的Confirmation在broker确认(ack/nack)该消息后完成
+	PublishWithConfirm(ctx context.Context, msg *XPublishMsg) (Confirmation, error)
+
+	// PublishValue 使用解码器编码v并发送，ContentType由解码器决定，其余属性通过opts设置
+	PublishValue(ctx context.Context, v interface{}, opts ...PublishOption) (Confirmation, error)
+
 	// Cancel 关闭通信管道，释放资源
 	Cancel() error
 }
 
+// Confirmation 一条消息的确认结果
+type Confirmation interface {
+	// Message 被确认的消息
+	Message() *XPublishMsg
+
+	// Done broker确认该消息，或生产者关闭导致该消息无法被确认时关闭
+	Done() <-chan struct{}
+
+	// Err Done关闭后得到确认结果：ack时为nil，nack或生产者关闭时为对应的错误
+	Err() error
+
+	// Wait 等待确认结果，ctx到期时返回ctx.Err()
+	Wait(ctx context.Context) error
+}
+
 // 消费者
 type Consumer interface {
 	// Qos 即服务质量保证
@@ -25,10 +51,75 @@ type Consumer interface {
 	// Consume 开始消费，阻塞式
 	Consume(func(delivery XDelivery)) error
 
+	// ConsumeFunc 开始消费，阻塞式
+	// handler返回nil时确认消息，返回错误或panic时按照消费者配置的策略拒绝消息，handler无需自行确认
+	ConsumeFunc(handler HandleFunc) error
+
+	// ConsumeTyped 开始消费，阻塞式
+	// handler形如func(ctx context.Context, msg *OrderCreated, meta Meta) error，
+	// 消息体根据ContentType选择解码器解码为msg；确认消息的方式同ConsumeFunc；
+	// 解码失败的消息交给消费者配置的PoisonHandler处理
+	ConsumeTyped(handler interface{}) error
+
+	// Bind 将消费的队列以args绑定到exchange的key上，exchange为空时为消费者的交换机
+	// headers交换机的绑定通过args指定要匹配的消息头；消费中时立即生效，断线重连后会重新绑定
+	Bind(key, exchange string, args XTable) error
+
+	// Unbind 解除消费的队列在exchange的key上以args建立的绑定，exchange为空时为消费者的交换机
+	// 交换机、key及args都相同才是同一个绑定；消费中时立即生效，断线重连后不会再绑定
+	Unbind(key, exchange string, args XTable) error
+
 	// Cancel 关闭通信管道，释放资源
 	Cancel() error
 }
 
+// HandleFunc 处理一条消息，ctx在消费者关闭时被取消
+type HandleFunc func(ctx context.Context, delivery XDelivery) error
+
+// Meta 消息的元数据，用于ConsumeTyped的handler
+type Meta struct {
+	Exchange        string
+	RoutingKey      string
+	Headers         XTable
+	ContentType     string
+	ContentEncoding string
+	DeliveryMode    uint8
+	Priority        uint8
+	CorrelationId   string
+	ReplyTo         string
+	Expiration      string
+	MessageId       string
+	Timestamp       time.Time
+	Type            string
+	UserId          string
+	AppId           string
+	Redelivered     bool
+	DeliveryTag     uint64
+}
+
+// NewMeta 得到消息的元数据
+func NewMeta(d XDelivery) Meta {
+	return Meta{
+		Exchange:        d.Exchange,
+		RoutingKey:      d.RoutingKey,
+		Headers:         d.Headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		Expiration:      d.Expiration,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Redelivered:     d.Redelivered,
+		DeliveryTag:     d.DeliveryTag,
+	}
+}
+
 // 生产者的构建者
 type ProducerBuilder interface {
 	// 简单模式
@@ -45,6 +136,9 @@ type ProducerBuilder interface {
 
 	// 话题模式
 	Topic(dynamic bool) (Producer, error)
+
+	// 头部模式
+	Headers() (Producer, error)
 }
 
 // 消费者的构建者
@@ -63,6 +157,9 @@ type ConsumerBuilder interface {
 
 	// 话题模式
 	Topic() (Consumer, error)
+
+	// 头部模式
+	Headers() (Consumer, error)
 }
 
 // exchange到queue成功,则不回调return
@@ -1,6 +1,9 @@
 package external
 
-import "github.com/streadway/amqp"
+import (
+	"github.com/streadway/amqp"
+	"time"
+)
 
 // 等价替换：目的是为了让外部包/文件在使用xrabbitmq的时候不用导入"github.com/streadway/amqp"
 
@@ -26,18 +29,77 @@ type (
 	XConfirmation = amqp.Confirmation
 
 	XQueue = amqp.Queue
+
+	XConfig = amqp.Config
+
+	XAuthentication = amqp.Authentication
 )
 
 type XPublishMsg struct {
 	RoutingKey  string // 路由key
 	ContentType string // "text/plain" "application/octet-stream" 可以不填
 	Body        []byte // data
+
+	Headers         XTable    // 消息头，headers交换机根据它来路由
+	ContentEncoding string    // MIME content encoding
+	DeliveryMode    uint8     // XTransient(0或1) 或 XPersistent(2)
+	Priority        uint8     // 0 to 9
+	CorrelationId   string    // correlation identifier
+	ReplyTo         string    // address to to reply to (ex: RPC)
+	Expiration      string    // 消息过期时间，单位毫秒，如"60000"
+	MessageId       string    // message identifier
+	Timestamp       time.Time // message timestamp
+	Type            string    // message type name
+	UserId          string    // creating user id - ex: "guest"，必须与连接的用户一致
+	AppId           string    // creating application id
+}
+
+// PublishOption 设置要发送的消息的属性
+type PublishOption = func(msg *XPublishMsg)
+
+// Publishing 得到发送给broker的消息
+func (m *XPublishMsg) Publishing() XPublishing {
+	return XPublishing{
+		Headers:         m.Headers,
+		ContentType:     m.ContentType,
+		ContentEncoding: m.ContentEncoding,
+		DeliveryMode:    m.DeliveryMode,
+		Priority:        m.Priority,
+		CorrelationId:   m.CorrelationId,
+		ReplyTo:         m.ReplyTo,
+		Expiration:      m.Expiration,
+		MessageId:       m.MessageId,
+		Timestamp:       m.Timestamp,
+		Type:            m.Type,
+		UserId:          m.UserId,
+		AppId:           m.AppId,
+		Body:            m.Body,
+	}
 }
 
 func XDial(url string) (*XConnection, error) {
 	return amqp.Dial(url)
 }
 
+func XParseURI(uri string) (XURI, error) {
+	return amqp.ParseURI(uri)
+}
+
+func XDialConfig(url string, config XConfig) (*XConnection, error) {
+	return amqp.DialConfig(url, config)
+}
+
+// XExternalAuth SASL EXTERNAL认证，由TLS客户端证书完成身份认证，不再需要用户名/密码
+type XExternalAuth struct{}
+
+func (auth *XExternalAuth) Mechanism() string {
+	return "EXTERNAL"
+}
+
+func (auth *XExternalAuth) Response() string {
+	return ""
+}
+
 const (
 	ContentTooLarge    = amqp.ContentTooLarge
 	NoRoute            = amqp.NoRoute
@@ -59,9 +121,47 @@ const (
 	InternalError      = amqp.InternalError
 )
 
+const (
+	XTransient  = amqp.Transient
+	XPersistent = amqp.Persistent
+)
+
 const (
 	XExchangeDirect  = amqp.ExchangeDirect
 	XExchangeFanout  = amqp.ExchangeFanout
 	XExchangeTopic   = amqp.ExchangeTopic
 	XExchangeHeaders = amqp.ExchangeHeaders
 )
+
+const (
+	// XPreconditionFailed 重复声明时属性与服务端已存在的不一致
+	XPreconditionFailed = amqp.PreconditionFailed
+	XNotFound           = amqp.NotFound
+)
+
+// ErrClosed 连接/通信管道已关闭
+var ErrClosed = amqp.ErrClosed
+
+// Republishing 根据收到的消息得到重新发送的消息，保留消息的所有属性，消息头被复制以便修改
+func Republishing(delivery XDelivery) XPublishing {
+	headers := make(XTable, len(delivery.Headers)+1)
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+	return XPublishing{
+		Headers:         headers,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		DeliveryMode:    delivery.DeliveryMode,
+		Priority:        delivery.Priority,
+		CorrelationId:   delivery.CorrelationId,
+		ReplyTo:         delivery.ReplyTo,
+		Expiration:      delivery.Expiration,
+		MessageId:       delivery.MessageId,
+		Timestamp:       delivery.Timestamp,
+		Type:            delivery.Type,
+		UserId:          delivery.UserId,
+		AppId:           delivery.AppId,
+		Body:            delivery.Body,
+	}
+}
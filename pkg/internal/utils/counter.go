@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// Counter 可以在ctx控制下等待归零的计数器，类似于sync.WaitGroup
+type Counter struct {
+	mu sync.Mutex
+
+	n int
+
+	// zero 计数归零时关闭
+	zero chan struct{}
+}
+
+// Add 计数加delta，delta可以为负数
+func (c *Counter) Add(delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.zero == nil {
+		c.zero = make(chan struct{})
+		close(c.zero)
+	}
+	if c.n == 0 && delta > 0 {
+		c.zero = make(chan struct{})
+	}
+	c.n += delta
+	if c.n < 0 {
+		panic("utils: negative Counter")
+	}
+	if c.n == 0 && delta < 0 {
+		close(c.zero)
+	}
+}
+
+// Done 计数减一
+func (c *Counter) Done() {
+	c.Add(-1)
+}
+
+// Count 当前计数
+func (c *Counter) Count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+// Wait 等待计数归零，ctx到期时返回ctx.Err()
+func (c *Counter) Wait(ctx context.Context) error {
+	c.mu.Lock()
+	if c.n == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	zero := c.zero
+	c.mu.Unlock()
+
+	select {
+	case <-zero:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
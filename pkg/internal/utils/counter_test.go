@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCounterWait(t *testing.T) {
+	cases := []struct {
+		name string
+		add  int
+		// done 在Wait期间完成的计数
+		done    int
+		timeout time.Duration
+		want    error
+	}{
+		{"zero value", 0, 0, time.Second, nil},
+		{"all done while waiting", 2, 2, time.Second, nil},
+		{"deadline before zero", 2, 1, 50 * time.Millisecond, context.DeadlineExceeded},
+	}
+	for _, c := range cases {
+		var counter Counter
+		counter.Add(c.add)
+		go func(done int) {
+			for i := 0; i < done; i++ {
+				time.Sleep(5 * time.Millisecond)
+				counter.Done()
+			}
+		}(c.done)
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		err := counter.Wait(ctx)
+		cancel()
+		if err != c.want {
+			t.Errorf("%s: Wait = %v, want %v", c.name, err, c.want)
+		}
+		if want := c.add - c.done; err == nil && counter.Count() != want {
+			t.Errorf("%s: Count = %d, want %d", c.name, counter.Count(), want)
+		}
+	}
+}
+
+func TestCounterReuse(t *testing.T) {
+	var counter Counter
+	counter.Add(1)
+	counter.Done()
+	if err := counter.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait after reaching zero = %v", err)
+	}
+
+	// 归零后再次计数，Wait需要等待新的计数归零
+	counter.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := counter.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wait on reused counter = %v, want %v", err, context.DeadlineExceeded)
+	}
+	counter.Done()
+	if err := counter.Wait(context.Background()); err != nil {
+		t.Errorf("Wait after reused counter reached zero = %v", err)
+	}
+}
+
+func TestCounterNegative(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Done on zero Counter did not panic")
+		}
+	}()
+	var counter Counter
+	counter.Done()
+}
@@ -0,0 +1,402 @@
+// 通信管道池，多个生产者共享一组通信管道，避免为每个生产者都开辟新的通信管道
+package pool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"xrabbitmq/pkg/external"
+)
+
+var (
+	// ErrPoolClosed 通信管道池已关闭
+	ErrPoolClosed = errors.New("pool: channel pool closed")
+
+	// ErrNacked 消息被broker拒绝(nack)
+	ErrNacked = errors.New("pool: message nacked by broker")
+
+	// ErrChannelClosed 通信管道在消息被确认前关闭，消息可能未到达broker
+	ErrChannelClosed = errors.New("pool: channel closed before message confirmed")
+
+	// ErrReturned mandatory的消息未被路由到任何队列而被退回
+	ErrReturned = errors.New("pool: message returned unroutable")
+)
+
+// ConfirmFunc 消息的确认结果：ack时为nil，nack时为ErrNacked，通信管道在确认前关闭时为ErrChannelClosed
+// 在转发确认的协程中调用，不能阻塞
+type ConfirmFunc func(err error)
+
+// ReturnFunc 消息未被路由而被退回时调用，先于该消息的ConfirmFunc；同样不能阻塞
+type ReturnFunc func(msg external.XReturn)
+
+// Pool 有上限的通信管道池
+// 生产者每次发送时借出通信管道，发送后立即归还，所以池的大小限制的是同时发送的生产者数，而不是生产者的总数；
+// 通信管道在第一次被借出时才会开辟并开启消息确认，归还后保留以供复用；
+// 被channel级别异常关闭、或因连接断开而失效的通信管道会被丢弃，下次借出时重新开辟
+type Pool struct {
+	// conn 得到当前的连接，断线重连后会返回新的连接
+	conn func() *external.XConnection
+
+	// slots 限制同时被借出的通信管道数
+	slots chan struct{}
+
+	mu sync.Mutex
+
+	// idle 空闲的通信管道
+	idle []*Channel
+
+	closed bool
+}
+
+// New 创建一个最多同时借出size个通信管道的通信管道池
+func New(size int, conn func() *external.XConnection) *Pool {
+	if size <= 0 {
+		size = 1
+	}
+	return &Pool{
+		conn:  conn,
+		slots: make(chan struct{}, size),
+	}
+}
+
+// Get 借出一个可用的通信管道，池中的通信管道都被借出时阻塞，直到有通信管道被归还或ctx到期
+// 使用完后必须通过Put归还
+func (p *Pool) Get(ctx context.Context) (*Channel, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+		return nil, ErrPoolClosed
+	}
+	for len(p.idle) > 0 {
+		c := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if !c.Closed() {
+			p.mu.Unlock()
+			return c, nil
+		}
+	}
+	p.mu.Unlock()
+
+	conn := p.conn()
+	if conn == nil || conn.IsClosed() {
+		<-p.slots
+		return nil, ErrChannelClosed
+	}
+	c, err := open(conn)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+// Put 归还通信管道，已关闭的通信管道会被丢弃
+// 归还时还未被确认的消息不受影响，确认结果仍然交给发送时传入的回调
+func (p *Pool) Put(c *Channel) {
+	p.mu.Lock()
+	if p.closed || c.Closed() {
+		p.mu.Unlock()
+		c.Close()
+	} else {
+		p.idle = append(p.idle, c)
+		p.mu.Unlock()
+	}
+	<-p.slots
+}
+
+// Close 关闭通信管道池及所有空闲的通信管道
+// 仍被借出的通信管道会在归还时关闭
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for _, c := range p.idle {
+		c.Close()
+	}
+	p.idle = nil
+}
+
+// Stats 得到空闲及已借出的通信管道数
+func (p *Pool) Stats() (idle, inUse int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle), len(p.slots)
+}
+
+// pending 已发送(或正在发送)但还未被确认的消息
+type pending struct {
+	tag uint64
+
+	// exchange/key/body 用于将退回的消息对应到发送者
+	exchange string
+	key      string
+	body     []byte
+
+	confirmed ConfirmFunc
+	returned  ReturnFunc
+
+	// sent 消息已成功写入通信管道，通信管道关闭时需要通知发送者
+	sent bool
+
+	// bounced 消息已被退回
+	bounced bool
+}
+
+// Channel 从通信管道池中借出的通信管道
+// 通信管道在开辟时即开启消息确认，并自己记录DeliveryTag；
+// 确认/退回消息按照DeliveryTag交给发送时传入的回调，不会被之后的借用者收到
+type Channel struct {
+	channel *external.XChannel
+
+	conn *external.XConnection
+
+	// publishMu 串行化发送及DeliveryTag的分配，发送时不能持有mu：
+	// amqp在投递确认时持有其内部的锁，而转发确认需要mu
+	publishMu sync.Mutex
+
+	// published 最后一条成功发送的消息的DeliveryTag，与amqp内部的计数一致
+	published uint64
+
+	// mu 保护pending/closed
+	mu sync.Mutex
+
+	// pending 还未被确认的消息，按照DeliveryTag排序
+	pending []*pending
+
+	closed bool
+}
+
+// open 在连接上开辟一个新的通信管道，开启消息确认并开始转发其确认/退回消息
+func open(conn *external.XConnection) (*Channel, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	c, err := Wrap(conn, channel)
+	if err != nil {
+		_ = channel.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Wrap 在已开辟的通信管道上开启消息确认，并开始转发其确认/退回消息，用于池外需要确认的发送
+// 通信管道必须是新开辟的、未开启过消息确认的，DeliveryTag才能从1开始对应；conn可以为nil
+func Wrap(conn *external.XConnection, channel *external.XChannel) (*Channel, error) {
+	if err := channel.Confirm(false); err != nil {
+		return nil, err
+	}
+	c := &Channel{
+		channel: channel,
+		conn:    conn,
+	}
+	// 退回的消息不设缓冲：amqp在同一个协程中先投递退回再投递确认，
+	// 退回被forward取走后确认才会到达，有缓冲时两者可能同时就绪而被select以任意顺序取出
+	go c.forward(
+		channel.NotifyPublish(make(chan external.XConfirmation, 1)),
+		channel.NotifyReturn(make(chan external.XReturn)),
+	)
+	return c, nil
+}
+
+// Channel 得到底层的通信管道，用于声明交换机/队列；消息必须通过Publish发送
+func (c *Channel) Channel() *external.XChannel {
+	return c.channel
+}
+
+// Conn 得到通信管道所在的连接
+func (c *Channel) Conn() *external.XConnection {
+	return c.conn
+}
+
+// Closed 通信管道是否已关闭，连接断开时通信管道也随之失效
+func (c *Channel) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed || (c.conn != nil && c.conn.IsClosed())
+}
+
+// Close 关闭通信管道，归还后会被丢弃；一般在通信管道上的操作出错后使用
+// 还未被确认的消息以ErrChannelClosed结束
+func (c *Channel) Close() {
+	_ = c.channel.Close()
+	c.shutdown()
+}
+
+// Publish 发送一条消息，broker确认后以确认结果调用confirmed；mandatory的消息未被路由时，先调用returned
+// 返回错误时消息未被发送，confirmed不会被调用
+func (c *Channel) Publish(exchange, key string, mandatory bool, msg external.XPublishing, confirmed ConfirmFunc, returned ReturnFunc) error {
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+
+	// 先登记再发送，使得发送期间到达的确认也能对应上
+	p, err := c.track(exchange, key, msg.Body, confirmed, returned)
+	if err != nil {
+		return err
+	}
+	if err := c.channel.Publish(exchange, key, mandatory, false, msg); err != nil {
+		c.mu.Lock()
+		c.remove(p)
+		c.mu.Unlock()
+		return err
+	}
+	c.published = p.tag
+	c.markSent(p)
+	return nil
+}
+
+// track 登记一条即将发送的消息，DeliveryTag为最后一条成功发送的消息的下一个；调用者需持有publishMu
+func (c *Channel) track(exchange, key string, body []byte, confirmed ConfirmFunc, returned ReturnFunc) (*pending, error) {
+	p := &pending{
+		tag:       c.published + 1,
+		exchange:  exchange,
+		key:       key,
+		body:      body,
+		confirmed: confirmed,
+		returned:  returned,
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrChannelClosed
+	}
+	c.pending = append(c.pending, p)
+	return p, nil
+}
+
+// markSent 消息已写入通信管道；发送期间通信管道已关闭时shutdown跳过了这条消息，由这里通知发送者
+func (c *Channel) markSent(p *pending) {
+	c.mu.Lock()
+	p.sent = true
+	abandoned := c.closed && c.remove(p)
+	c.mu.Unlock()
+	if abandoned {
+		p.confirmed(ErrChannelClosed)
+	}
+}
+
+// PublishWait 发送一条mandatory消息并阻塞等待broker确认，消息未被路由时返回ErrReturned
+func (c *Channel) PublishWait(exchange, key string, msg external.XPublishing) error {
+	var returned bool
+	confirmed := make(chan error, 1)
+	err := c.Publish(exchange, key, true, msg,
+		func(err error) { confirmed <- err },
+		// 退回先于确认，且都在转发的协程中调用
+		func(external.XReturn) { returned = true },
+	)
+	if err != nil {
+		return err
+	}
+	if err := <-confirmed; err != nil {
+		return err
+	}
+	if returned {
+		return ErrReturned
+	}
+	return nil
+}
+
+// remove 移除一条还未被确认的消息，调用者需持有mu
+func (c *Channel) remove(p *pending) bool {
+	for i, v := range c.pending {
+		if v == p {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// forward 将确认/退回消息交给发送者，直到通信管道关闭
+func (c *Channel) forward(confirms chan external.XConfirmation, returns chan external.XReturn) {
+	for {
+		select {
+		case confirmed, ok := <-confirms:
+			if !ok {
+				c.shutdown()
+				return
+			}
+			c.confirm(confirmed)
+		case msg, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.bounce(msg)
+		}
+	}
+}
+
+// confirm 将一个ack/nack交给对应的发送者
+// broker的multiple确认会被amqp拆分为逐条的确认，并按照DeliveryTag的顺序送达
+func (c *Channel) confirm(confirmed external.XConfirmation) {
+	c.mu.Lock()
+	var p *pending
+	for i, v := range c.pending {
+		if v.tag == confirmed.DeliveryTag {
+			p = v
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			break
+		}
+	}
+	c.mu.Unlock()
+	if p == nil {
+		return
+	}
+	if confirmed.Ack {
+		p.confirmed(nil)
+	} else {
+		p.confirmed(ErrNacked)
+	}
+}
+
+// bounce 将退回的消息交给最早发送的、交换机/routing-key/消息体都相同的发送者
+// broker在确认之前退回消息，所以该消息一定还未被确认
+func (c *Channel) bounce(msg external.XReturn) {
+	c.mu.Lock()
+	var p *pending
+	for _, v := range c.pending {
+		if !v.bounced && v.exchange == msg.Exchange && v.key == msg.RoutingKey && bytes.Equal(v.body, msg.Body) {
+			p = v
+			p.bounced = true
+			break
+		}
+	}
+	c.mu.Unlock()
+	if p != nil && p.returned != nil {
+		p.returned(msg)
+	}
+}
+
+// shutdown 通信管道关闭后，已发送但还未被确认的消息以ErrChannelClosed结束
+// 正在发送的消息由Publish返回错误
+func (c *Channel) shutdown() {
+	c.mu.Lock()
+	c.closed = true
+	var closed []*pending
+	remain := c.pending[:0]
+	for _, p := range c.pending {
+		if p.sent {
+			closed = append(closed, p)
+		} else {
+			remain = append(remain, p)
+		}
+	}
+	c.pending = remain
+	c.mu.Unlock()
+
+	for _, p := range closed {
+		p.confirmed(ErrChannelClosed)
+	}
+}
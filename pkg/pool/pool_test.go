@@ -0,0 +1,185 @@
+package pool
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"xrabbitmq/pkg/external"
+)
+
+// outcomes 每条消息收到的退回/确认结果
+type outcomes [][]string
+
+// publish 像Publish一样登记一条消息，sent为false时表示还在发送中
+func (o *outcomes) publish(c *Channel, key, body string, sent bool) {
+	i := len(*o)
+	*o = append(*o, nil)
+	p, err := c.track("orders", key, []byte(body),
+		func(err error) {
+			result := "ack"
+			switch err {
+			case ErrNacked:
+				result = "nack"
+			case ErrChannelClosed:
+				result = "closed"
+			}
+			(*o)[i] = append((*o)[i], result)
+		},
+		func(external.XReturn) { (*o)[i] = append((*o)[i], "returned") },
+	)
+	if err != nil {
+		panic(err)
+	}
+	c.published = p.tag
+	if sent {
+		c.markSent(p)
+	}
+}
+
+func TestChannelForward(t *testing.T) {
+	ack := func(tag uint64) interface{} { return external.XConfirmation{DeliveryTag: tag, Ack: true} }
+	nack := func(tag uint64) interface{} { return external.XConfirmation{DeliveryTag: tag} }
+	bounce := func(key, body string) interface{} {
+		return external.XReturn{Exchange: "orders", RoutingKey: key, Body: []byte(body)}
+	}
+
+	cases := []struct {
+		name string
+		// bodies 依次发送的消息，以"~"开头的消息还在发送中
+		bodies []string
+		events []interface{}
+		want   outcomes
+	}{
+		{
+			name:   "ack and nack by tag",
+			bodies: []string{"a", "b", "c"},
+			events: []interface{}{ack(2), nack(1), ack(3)},
+			want:   outcomes{{"nack"}, {"ack"}, {"ack"}},
+		},
+		{
+			name:   "unknown tag ignored",
+			bodies: []string{"a"},
+			events: []interface{}{ack(7), ack(1)},
+			want:   outcomes{{"ack"}},
+		},
+		{
+			name:   "return before confirm",
+			bodies: []string{"a", "b"},
+			events: []interface{}{bounce("k", "b"), ack(1), ack(2)},
+			want:   outcomes{{"ack"}, {"returned", "ack"}},
+		},
+		{
+			name:   "identical messages returned in order",
+			bodies: []string{"a", "a", "a"},
+			events: []interface{}{bounce("k", "a"), ack(1), bounce("k", "a"), ack(2), ack(3)},
+			want:   outcomes{{"returned", "ack"}, {"returned", "ack"}, {"ack"}},
+		},
+		{
+			name:   "return for another key ignored",
+			bodies: []string{"a"},
+			events: []interface{}{bounce("other", "a"), ack(1)},
+			want:   outcomes{{"ack"}},
+		},
+		{
+			name:   "shutdown fails sent messages only",
+			bodies: []string{"a", "b", "~c"},
+			events: []interface{}{ack(1)},
+			want:   outcomes{{"ack"}, {"closed"}, nil},
+		},
+	}
+	for _, c := range cases {
+		ch := &Channel{}
+		var got outcomes
+		for _, body := range c.bodies {
+			sending := strings.HasPrefix(body, "~")
+			got.publish(ch, "k", strings.TrimPrefix(body, "~"), !sending)
+		}
+
+		confirms := make(chan external.XConfirmation)
+		returns := make(chan external.XReturn)
+		done := make(chan struct{})
+		go func() {
+			ch.forward(confirms, returns)
+			close(done)
+		}()
+		for _, event := range c.events {
+			switch event := event.(type) {
+			case external.XConfirmation:
+				confirms <- event
+			case external.XReturn:
+				returns <- event
+			}
+		}
+		close(confirms)
+		<-done
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: outcomes = %v, want %v", c.name, got, c.want)
+		}
+		if !ch.Closed() {
+			t.Errorf("%s: channel not closed after confirms closed", c.name)
+		}
+	}
+}
+
+func TestChannelAbandonedPublish(t *testing.T) {
+	ch := &Channel{}
+	var got outcomes
+	// 第一条消息已发送，第二条在发送期间通信管道关闭
+	got.publish(ch, "k", "a", true)
+	got.publish(ch, "k", "b", false)
+	ch.shutdown()
+	ch.markSent(ch.pending[0])
+
+	want := outcomes{{"closed"}, {"closed"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("outcomes = %v, want %v", got, want)
+	}
+	if len(ch.pending) != 0 {
+		t.Errorf("%d messages still pending", len(ch.pending))
+	}
+
+	// 关闭后不再登记新的消息
+	if _, err := ch.track("orders", "k", nil, func(error) {}, nil); err != ErrChannelClosed {
+		t.Errorf("track on closed channel = %v, want %v", err, ErrChannelClosed)
+	}
+}
+
+func TestPoolGet(t *testing.T) {
+	cases := []struct {
+		name   string
+		closed bool
+		busy   bool
+		want   error
+	}{
+		{"connection down", false, false, ErrChannelClosed},
+		{"pool closed", true, false, ErrPoolClosed},
+		{"all channels in use", false, true, context.DeadlineExceeded},
+	}
+	for _, c := range cases {
+		p := New(1, func() *external.XConnection { return nil })
+		if c.closed {
+			p.Close()
+		}
+		if c.busy {
+			p.slots <- struct{}{}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := p.Get(ctx)
+		cancel()
+		if err != c.want {
+			t.Errorf("%s: Get = %v, want %v", c.name, err, c.want)
+		}
+		// 失败的Get不占用通信管道
+		want := 0
+		if c.busy {
+			want = 1
+		}
+		if _, inUse := p.Stats(); inUse != want {
+			t.Errorf("%s: %d channels in use after failed Get, want %d", c.name, inUse, want)
+		}
+	}
+}
@@ -1,16 +1,20 @@
 package producer
 
 import (
+	"context"
 	"fmt"
-	"github.com/streadway/amqp"
+	"sync"
 	"xrabbitmq/pkg/external"
 	"xrabbitmq/pkg/internal/utils"
 	"xrabbitmq/pkg/log"
 	"xrabbitmq/pkg/session"
-	"sync"
-	"time"
+	"xrabbitmq/pkg/session/produceropts"
 )
 
+// DeclareFunc 在通信管道上声明生产者所需的交换机/队列
+// 会话恢复后会被再次调用，所以必须是幂等的
+type DeclareFunc func(channel *external.XChannel) error
+
 type Producer struct {
 	// session 消费者与交换机/队列/binding的声明保障
 	// 消费者会占用一个RabbitMQ的通信管道，不要忘记使用 Consumer.Cancel() 来释放它
@@ -28,13 +32,42 @@ type Producer struct {
 
 	// producer model simple/work/publish/routing/topic
 	model Model
+
+	// returnHandler 通过NotifyReturn设置的回调，会话恢复后需要重新监听
+	returnHandler external.ReturnHandleFunc
+
+	// returning 正在监听未被路由消息的通信管道
+	returning *external.XChannel
+
+	// outstanding 已经读取但还未被broker确认的消息数
+	outstanding utils.Counter
+
+	// draining 关闭时停止读取新的消息
+	draining  chan struct{}
+	drainOnce sync.Once
+
+	// confirmer 发送消息并等待broker确认
+	confirmer confirmer
+
+	// window 限制同时等待broker确认的消息数
+	window chan struct{}
+
+	// declaredOn 使用通信管道池时，已声明过交换机/队列的连接
+	declaredOn *external.XConnection
+	declareMu  sync.Mutex
 }
 
 func NewProducer(sess *session.Session, mod Model) *Producer {
+	window := sess.OptionsProducer().MaxOutstanding
+	if window <= 0 {
+		window = produceropts.DefaultMaxOutstanding
+	}
 	return &Producer{
-		session: sess,
-		done:    make(chan error),
-		model:   mod,
+		session:  sess,
+		done:     make(chan error),
+		model:    mod,
+		draining: make(chan struct{}),
+		window:   make(chan struct{}, window),
 	}
 }
 
@@ -50,7 +83,7 @@ func (p *Producer) Cancel() error {
 func (p *Producer) releaseChannel() (err error) {
 	defer func() {
 		p.cancelOnce.Do(func() {
-			err = utils.CancelChannel(p.session.Channel(), p.session.OptionsProducer().Tag)
+			err = p.session.Release(p.session.OptionsProducer().Tag)
 		})
 	}()
 
@@ -61,15 +94,48 @@ func (p *Producer) releaseChannel() (err error) {
 	return <-p.done
 }
 
+// Drain 停止读取新的消息，并等待已发送的消息被broker确认
+// ctx到期时返回未被确认的消息数
+func (p *Producer) Drain(ctx context.Context) error {
+	p.drainOnce.Do(func() {
+		close(p.draining)
+	})
+	if err := p.outstanding.Wait(ctx); err != nil {
+		return fmt.Errorf("%s abandoned %d unconfirmed messages: %w", p.model, p.outstanding.Count(), err)
+	}
+	p.session.Close()
+	return nil
+}
+
 func (p *Producer) NotifyReturn(handleFunc external.ReturnHandleFunc) {
+	p.returnHandler = handleFunc
+	p.listenReturn(p.session.Channel())
+}
+
+// listenReturn 在通信管道上监听未被路由的消息，通信管道关闭后退出
+func (p *Producer) listenReturn(channel *external.XChannel) {
+	if p.returnHandler == nil || p.returning == channel {
+		return
+	}
+	p.returning = channel
+	handleFunc := p.returnHandler
+	returns := channel.NotifyReturn(make(chan external.XReturn, 1))
 	go func() {
 		defer func() {
 			if x := recover(); x != nil {
 				log.Logger.Errorf("producer listen panic: %+v", x)
 			}
 		}()
-		for msg := range p.session.Channel().NotifyReturn(make(chan external.XReturn, 1)) {
-			handleFunc(msg)
+		for {
+			select {
+			case msg, ok := <-returns:
+				if !ok {
+					return
+				}
+				handleFunc(msg)
+			case <-p.session.Done():
+				return
+			}
 		}
 	}()
 }
@@ -192,82 +258,53 @@ func (p *Producer) key(customKey string) string {
 		return customKey
 	case ModelWork, ModelSimple:
 		return p.session.Queue().Name
-	case ModelPublish:
+	case ModelPublish, ModelHeaders:
 		return ""
 	}
 	log.Logger.Error("producer get key error: %s", p.model)
 	return ""
 }
 
-func (p *Producer) Publish(messages <-chan *external.XPublishMsg) {
+// Publish 声明交换机/队列后开始发送消息，阻塞式
+// 消息被流水线式地发送，同时等待确认的消息数达到MaxOutstanding时才会等待确认；
+// 通信管道因断线等原因被重建后，未被确认的消息会被重新发送。所有消息发送完毕后，等待它们都被确认再返回
+func (p *Producer) Publish(declare DeclareFunc, messages <-chan *external.XPublishMsg) error {
 	p.messages = messages
-	var (
-		exchangeOptions = p.session.Exchange()
-		producerOptions = p.session.OptionsProducer()
-		pub             = p.session.Channel()
-		reading         = p.messages
-		pending         = make(chan *external.XPublishMsg, 1)
-		confirm         = make(chan external.XConfirmation, 1)
-	)
-
-	if err := pub.Confirm(false); err != nil {
-		log.Logger.Error("publisher confirms not supported")
-		close(confirm)
-	} else {
-		pub.NotifyPublish(confirm)
-	}
 
 	log.Logger.Info("publishing...")
 
-Publish:
 	for {
-		var body *external.XPublishMsg
 		select {
-		case confirmed, ok := <-confirm:
-			if !ok {
-				break Publish
-			}
-			if !confirmed.Ack {
-				log.Logger.Error("nack message %d, body: %q", confirmed.DeliveryTag, string(body.Body))
-			}
-			reading = messages
+		case <-p.draining:
+			// 停止读取新的消息，由Drain等待已发送的消息被确认
+			return nil
 
-		case body = <-pending:
-			if body == nil {
-				return
-			}
-			fmt.Println("recv body:", string(body.Body))
-
-			// 模拟复杂度
-			time.Sleep(time.Millisecond * 20)
-
-			err := pub.Publish(
-				exchangeOptions.Name,
-				p.key(body.RoutingKey),
-				producerOptions.Mandatory,
-				false,
-				amqp.Publishing{
-					ContentType: body.ContentType,
-					Body:        body.Body,
-				})
-			// Retry failed delivery
-			if err != nil {
-				log.Logger.Errorf("producer send error: %s will retry after 1s", err)
-				time.Sleep(time.Second * 1)
-				pending <- body
-				break Publish
-			}
-
-		case body = <-reading:
-			// fmt.Println("recv pub body:", string(body))
+		case body := <-messages:
 			// all messages consumed
 			if body == nil {
-				fmt.Println("recv nil, return now.")
-				return
+				return p.outstanding.Wait(context.Background())
+			}
+			if _, err := p.PublishWithConfirm(context.Background(), declare, body); err != nil {
+				if err == ErrClosed {
+					return nil
+				}
+				return err
 			}
-			// work on pending delivery until ack'd
-			pending <- body
-			reading = nil
 		}
 	}
 }
+
+// prepare 在通信管道上声明交换机/队列、开启消息确认并重新监听未被路由的消息
+func (p *Producer) prepare(pub *external.XChannel, declare DeclareFunc) (chan external.XConfirmation, error) {
+	if err := declare(pub); err != nil {
+		return nil, err
+	}
+	if err := pub.Confirm(false); err != nil {
+		log.Logger.Error("publisher confirms not supported")
+		return nil, err
+	}
+	p.listenReturn(pub)
+	// 同时等待确认的消息数不超过发送窗口，监听者的容量与之相同，amqp投递确认时不会阻塞
+	// 监听者注册在刚准备好的通信管道上，会话此时可能已经再次恢复
+	return pub.NotifyPublish(make(chan external.XConfirmation, cap(p.window))), nil
+}
@@ -0,0 +1,318 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+)
+
+var (
+	// ErrNacked 消息被broker拒绝(nack)
+	ErrNacked = errors.New("producer: message nacked by broker")
+
+	// ErrClosed 生产者已关闭或正在排空，消息未被确认
+	ErrClosed = errors.New("producer: closed before message confirmed")
+)
+
+const (
+	// recoverAttempts 会话恢复后重新声明/开启消息确认的最多尝试次数
+	recoverAttempts = 5
+
+	// recoverInterval/recoverMaxInterval 重新尝试前等待的初始/最大时长，每次翻倍
+	recoverInterval    = 100 * time.Millisecond
+	recoverMaxInterval = 5 * time.Second
+)
+
+// confirmation 一条消息的确认结果，实现了external.Confirmation
+type confirmation struct {
+	msg *external.XPublishMsg
+
+	// tag 消息在当前通信管道上的DeliveryTag，为0表示还未成功发送
+	tag uint64
+
+	done chan struct{}
+
+	err error
+}
+
+func newConfirmation(msg *external.XPublishMsg) *confirmation {
+	return &confirmation{msg: msg, done: make(chan struct{})}
+}
+
+func (c *confirmation) Message() *external.XPublishMsg {
+	return c.msg
+}
+
+func (c *confirmation) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *confirmation) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+func (c *confirmation) Wait(ctx context.Context) error {
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resolve 得到确认结果，只能调用一次
+func (c *confirmation) resolve(err error) {
+	c.err = err
+	close(c.done)
+}
+
+// confirmer 在开启了消息确认的通信管道上发送消息，并按照DeliveryTag将broker的ack/nack对应到每条消息
+// 通信管道被重建后，会重新声明、重新开启消息确认，并按原来的顺序重新发送还未被确认的消息
+type confirmer struct {
+	// publishMu 串行化通信管道上的发送及DeliveryTag的分配，保护channel/declare/nextTag/started
+	// 发送时不能持有mu：amqp在向确认监听者投递时持有其内部的锁，而分发确认需要mu
+	publishMu sync.Mutex
+
+	// channel 当前用于发送消息的通信管道
+	channel *external.XChannel
+
+	// declare 声明交换机/队列，会话恢复后需要重新声明
+	declare DeclareFunc
+
+	// nextTag 当前通信管道上最后一条消息的DeliveryTag
+	nextTag uint64
+
+	started bool
+
+	// mu 保护unconfirmed/stopped及每条消息的tag
+	mu sync.Mutex
+
+	// unconfirmed 已发送但还未被确认的消息，按照DeliveryTag排序
+	unconfirmed []*confirmation
+
+	stopped bool
+
+	// err 停止的原因，之后的发送返回该错误
+	err error
+}
+
+// PublishWithConfirm 发送一条消息，返回的Confirmation在broker确认(ack/nack)该消息后完成
+// 第一次调用时会声明交换机/队列并开启消息确认；通信管道被重建时，还未被确认的消息会被重新发送
+// 使用通信管道池时，每次发送都从池中借出通信管道，池中的通信管道都被借出时阻塞，直到ctx到期
+func (p *Producer) PublishWithConfirm(ctx context.Context, declare DeclareFunc, msg *external.XPublishMsg) (external.Confirmation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// 等待发送窗口
+	select {
+	case p.window <- struct{}{}:
+	case <-p.draining:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if p.session.Pooled() {
+		return p.publishPooled(ctx, declare, msg)
+	}
+
+	c := &p.confirmer
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+	if !c.started {
+		if err := p.startConfirmer(declare); err != nil {
+			<-p.window
+			return nil, err
+		}
+	}
+
+	conf := newConfirmation(msg)
+	c.mu.Lock()
+	if c.stopped {
+		err := c.err
+		c.mu.Unlock()
+		<-p.window
+		return nil, err
+	}
+	p.outstanding.Add(1)
+	c.unconfirmed = append(c.unconfirmed, conf)
+	c.mu.Unlock()
+
+	p.send(conf)
+	return conf, nil
+}
+
+// startConfirmer 在当前通信管道上开启消息确认，并开始分发确认结果，调用者需持有confirmer.publishMu
+// 会话的通信管道只用于这个生产者，且不会被重复开启消息确认，所以DeliveryTag从1开始
+func (p *Producer) startConfirmer(declare DeclareFunc) error {
+	c := &p.confirmer
+	channel := p.session.Channel()
+	confirms, err := p.prepare(channel, declare)
+	if err != nil {
+		return err
+	}
+	c.channel, c.declare, c.nextTag, c.started = channel, declare, 0, true
+	go p.dispatch(confirms)
+	return nil
+}
+
+// send 在当前通信管道上发送消息，调用者需持有confirmer.publishMu
+// 消息的tag在发送前设置，使得发送期间到达的确认也能对应上；
+// 发送失败时通信管道已不可用，消息会在会话恢复后被重新发送
+func (p *Producer) send(conf *confirmation) {
+	c := &p.confirmer
+	tag := c.nextTag + 1
+	c.mu.Lock()
+	conf.tag = tag
+	c.mu.Unlock()
+
+	err := c.channel.Publish(
+		p.session.Exchange().Name,
+		p.key(conf.msg.RoutingKey),
+		p.session.OptionsProducer().Mandatory,
+		false,
+		conf.msg.Publishing(),
+	)
+	if err != nil {
+		c.mu.Lock()
+		conf.tag = 0
+		c.mu.Unlock()
+		log.Logger.Errorf("%s: send error: %s will retry after session recovered", p.model, err)
+		return
+	}
+	c.nextTag = tag
+}
+
+// dispatch 将broker的ack/nack分发给对应的消息，通信管道关闭后等待会话恢复并重新发送
+func (p *Producer) dispatch(confirms chan external.XConfirmation) {
+	defer func() {
+		if x := recover(); x != nil {
+			log.Logger.Errorf("producer dispatch panic: %+v", x)
+		}
+	}()
+
+	for {
+		select {
+		case confirmed, ok := <-confirms:
+			if ok {
+				p.confirm(confirmed)
+				continue
+			}
+			if confirms = p.recoverConfirmer(); confirms == nil {
+				return
+			}
+		case <-p.session.Done():
+			p.stopConfirmer(ErrClosed)
+			return
+		}
+	}
+}
+
+// confirm 将一个ack/nack对应到还未被确认的消息
+// broker的multiple确认会被amqp拆分为逐条的确认，并按照DeliveryTag的顺序送达，
+// 所以被确认的消息一般就是unconfirmed中的第一条
+func (p *Producer) confirm(confirmed external.XConfirmation) {
+	c := &p.confirmer
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, conf := range c.unconfirmed {
+		if conf.tag != confirmed.DeliveryTag {
+			continue
+		}
+		c.unconfirmed = append(c.unconfirmed[:i], c.unconfirmed[i+1:]...)
+		if confirmed.Ack {
+			p.finish(conf, nil)
+		} else {
+			log.Logger.Errorf("%s: nack message %d, body: %q", p.model, confirmed.DeliveryTag, string(conf.msg.Body))
+			p.finish(conf, ErrNacked)
+		}
+		return
+	}
+}
+
+// finish 消息得到确认结果，让出发送窗口
+func (p *Producer) finish(conf *confirmation, err error) {
+	conf.resolve(err)
+	p.outstanding.Done()
+	<-p.window
+}
+
+// recoverConfirmer 等待会话恢复，在新的通信管道上重新开启消息确认并重新发送还未被确认的消息
+// 声明及开启消息确认需要与broker往返，在持有锁之外完成；期间在旧通信管道上发送失败的消息同样会被重新发送
+// 准备失败时按退避等待后重试，连续失败recoverAttempts次后以该错误结束还未被确认的消息及之后的发送
+// 会话关闭或放弃恢复时返回nil
+func (p *Producer) recoverConfirmer() chan external.XConfirmation {
+	c := &p.confirmer
+	c.publishMu.Lock()
+	old, declare := c.channel, c.declare
+	c.publishMu.Unlock()
+
+	wait := recoverInterval
+	for attempt := 1; ; attempt++ {
+		channel, recovered := p.session.WaitRecovered(old)
+		if !recovered {
+			p.stopConfirmer(ErrClosed)
+			return nil
+		}
+		log.Logger.Warningf("%s: session recovered, republish now.", p.model)
+
+		confirms, err := p.prepare(channel, declare)
+		if err != nil {
+			log.Logger.Errorf("%s: prepare after recovered error: %s (attempt %d)", p.model, err, attempt)
+			if attempt >= recoverAttempts {
+				p.stopConfirmer(fmt.Errorf("%s: prepare after recovered error: %w", p.model, err))
+				return nil
+			}
+			// 声明失败时通信管道随即被会话重建，不等待会反复向broker声明
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-p.session.Done():
+				timer.Stop()
+				p.stopConfirmer(ErrClosed)
+				return nil
+			}
+			if wait *= 2; wait > recoverMaxInterval {
+				wait = recoverMaxInterval
+			}
+			old = channel
+			continue
+		}
+
+		c.publishMu.Lock()
+		// 会话恢复时总是开辟新的通信管道，开启消息确认后DeliveryTag从1开始
+		c.channel, c.nextTag = channel, 0
+		c.mu.Lock()
+		unconfirmed := append([]*confirmation(nil), c.unconfirmed...)
+		c.mu.Unlock()
+		for _, conf := range unconfirmed {
+			p.send(conf)
+		}
+		c.publishMu.Unlock()
+		return confirms
+	}
+}
+
+// stopConfirmer 会话关闭或放弃恢复后，还未被确认的消息以err结束，之后的发送也返回err
+func (p *Producer) stopConfirmer(err error) {
+	c := &p.confirmer
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	c.stopped, c.err = true, err
+	for _, conf := range c.unconfirmed {
+		p.finish(conf, err)
+	}
+	c.unconfirmed = nil
+}
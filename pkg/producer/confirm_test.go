@@ -0,0 +1,111 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+	"xrabbitmq/pkg/session/produceropts"
+)
+
+// pending 像PublishWithConfirm一样占用发送窗口，登记n条已发送的消息，DeliveryTag从1开始
+func pending(p *Producer, n int) []*confirmation {
+	confs := make([]*confirmation, n)
+	for i := range confs {
+		p.window <- struct{}{}
+		p.outstanding.Add(1)
+		confs[i] = newConfirmation(&external.XPublishMsg{})
+		confs[i].tag = uint64(i + 1)
+		p.confirmer.unconfirmed = append(p.confirmer.unconfirmed, confs[i])
+	}
+	return confs
+}
+
+func TestConfirmByTag(t *testing.T) {
+	stopped := errors.New("stopped")
+	cases := []struct {
+		name      string
+		confirms  []external.XConfirmation
+		stop      bool
+		want      []error
+		remaining int
+	}{
+		{
+			name:     "all acked",
+			confirms: []external.XConfirmation{{DeliveryTag: 1, Ack: true}, {DeliveryTag: 2, Ack: true}, {DeliveryTag: 3, Ack: true}},
+			want:     []error{nil, nil, nil},
+		},
+		{
+			name:      "nack and out of order",
+			confirms:  []external.XConfirmation{{DeliveryTag: 2}, {DeliveryTag: 1, Ack: true}},
+			want:      []error{nil, ErrNacked, nil},
+			remaining: 1,
+		},
+		{
+			name:      "unknown tag ignored",
+			confirms:  []external.XConfirmation{{DeliveryTag: 9, Ack: true}},
+			want:      []error{nil, nil, nil},
+			remaining: 3,
+		},
+		{
+			name:     "stop fails unconfirmed",
+			confirms: []external.XConfirmation{{DeliveryTag: 1, Ack: true}},
+			stop:     true,
+			want:     []error{nil, stopped, stopped},
+		},
+	}
+	for _, c := range cases {
+		p := NewProducer(session.NewSession(session.WithPublishingOptions(produceropts.SetMaxOutstanding(3))), ModelSimple)
+		confs := pending(p, 3)
+		for _, confirmed := range c.confirms {
+			p.confirm(confirmed)
+		}
+		if c.stop {
+			p.stopConfirmer(stopped)
+			// 重复停止不会再次结束消息
+			p.stopConfirmer(ErrClosed)
+		}
+
+		for i, conf := range confs {
+			if got := conf.Err(); got != c.want[i] {
+				t.Errorf("%s: message %d Err = %v, want %v", c.name, i+1, got, c.want[i])
+			}
+		}
+		if got := p.outstanding.Count(); got != c.remaining {
+			t.Errorf("%s: %d outstanding, want %d", c.name, got, c.remaining)
+		}
+		if got := len(p.window); got != c.remaining {
+			t.Errorf("%s: window holds %d, want %d", c.name, got, c.remaining)
+		}
+	}
+}
+
+func TestPublishWithConfirmWindow(t *testing.T) {
+	cases := []struct {
+		name  string
+		drain bool
+		want  error
+	}{
+		{"window full until deadline", false, context.DeadlineExceeded},
+		{"draining", true, ErrClosed},
+	}
+	for _, c := range cases {
+		p := NewProducer(session.NewSession(session.WithPublishingOptions(produceropts.SetMaxOutstanding(1))), ModelSimple)
+		pending(p, 1)
+		if c.drain {
+			close(p.draining)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		conf, err := p.PublishWithConfirm(ctx, nil, &external.XPublishMsg{})
+		cancel()
+		if conf != nil || err != c.want {
+			t.Errorf("%s: PublishWithConfirm = %v, %v, want nil, %v", c.name, conf, err, c.want)
+		}
+		if got := len(p.window); got != 1 {
+			t.Errorf("%s: window holds %d, want 1", c.name, got)
+		}
+	}
+}
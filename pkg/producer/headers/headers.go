@@ -0,0 +1,57 @@
+// Headers模式（头部模式，根据消息头的键值对而不是RoutingKey路由消息）
+// 1. 队列通过binding的Args绑定到headers交换机，Args中为要匹配的消息头键值对
+// 2. x-match为all时，消息头需要匹配所有的键值对；为any时，匹配任意一个即可
+// 3. 应用场景:按照租户、地域等多个属性路由消息
+
+package headers
+
+import (
+	"context"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+	"xrabbitmq/pkg/producer"
+	"xrabbitmq/pkg/session"
+)
+
+type headers struct {
+	*producer.Producer
+}
+
+func New(sess *session.Session) *headers {
+	return &headers{producer.NewProducer(sess, producer.ModelHeaders)}
+}
+
+func (p *headers) Publish(messages <-chan *external.XPublishMsg) (err error) {
+	defer p.Done(err)
+	return p.Producer.Publish(p.declare, messages)
+}
+
+func (p *headers) PublishWithConfirm(ctx context.Context, msg *external.XPublishMsg) (external.Confirmation, error) {
+	return p.Producer.PublishWithConfirm(ctx, p.declare, msg)
+}
+
+func (p *headers) PublishValue(ctx context.Context, v interface{}, opts ...external.PublishOption) (external.Confirmation, error) {
+	return p.Producer.PublishValue(ctx, p.declare, v, opts...)
+}
+
+// declare 声明交换机
+func (p *headers) declare(channel *external.XChannel) error {
+	// queueOptions := p.Sess().Queue()
+	exchangeOptions := p.Sess().Exchange()
+
+	err := channel.ExchangeDeclare(
+		exchangeOptions.Name,
+		exchangeOptions.Typ,
+		exchangeOptions.Durable,
+		exchangeOptions.AutoDelete,
+		exchangeOptions.Internal,
+		exchangeOptions.NoWait,
+		exchangeOptions.Args,
+	)
+
+	if err != nil {
+		log.Logger.Errorf("%s.ExchangeDeclare error: %s", p.Model(), err)
+		return err
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ const (
 	ModelRoutingDynamic
 	ModelTopic
 	ModelTopicDynamic
+	ModelHeaders
 )
 
 func (m Model) String() string {
@@ -28,6 +29,8 @@ func (m Model) String() string {
 		return "topic model producer"
 	case ModelTopicDynamic:
 		return "topicDynamic model producer"
+	case ModelHeaders:
+		return "headers model producer"
 	default:
 		return "unknown model producer"
 	}
@@ -0,0 +1,125 @@
+package producer
+
+import (
+	"context"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+	"xrabbitmq/pkg/pool"
+)
+
+// publishPooled 从通信管道池中借出通信管道发送一条消息，发送后立即归还
+// 确认结果由通信管道按DeliveryTag交回；通信管道在确认前关闭时，消息会被重新发送
+func (p *Producer) publishPooled(ctx context.Context, declare DeclareFunc, msg *external.XPublishMsg) (external.Confirmation, error) {
+	conf := newConfirmation(msg)
+	p.outstanding.Add(1)
+	if err := p.sendPooled(ctx, declare, conf); err != nil {
+		p.outstanding.Done()
+		<-p.window
+		return nil, err
+	}
+	return conf, nil
+}
+
+// sendPooled 借出通信管道，必要时声明交换机/队列，然后发送消息
+// 连接不可用时等待会话恢复；声明失败时返回错误
+func (p *Producer) sendPooled(ctx context.Context, declare DeclareFunc, conf *confirmation) error {
+	pl := p.session.Pool()
+	for {
+		c, err := pl.Get(ctx)
+		if err != nil {
+			if err == pool.ErrPoolClosed {
+				return ErrClosed
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Logger.Warningf("%s: get channel from pool error: %s, wait for session recovered", p.model, err)
+			select {
+			case <-p.session.Recovered():
+				if p.session.Closed() {
+					return ErrClosed
+				}
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := p.declareOn(c, declare); err != nil {
+			c.Close()
+			pl.Put(c)
+			return err
+		}
+		err = c.Publish(
+			p.session.Exchange().Name,
+			p.key(conf.msg.RoutingKey),
+			p.session.OptionsProducer().Mandatory,
+			conf.msg.Publishing(),
+			func(err error) { p.confirmPooled(declare, conf, err) },
+			p.returnPooled,
+		)
+		if err != nil {
+			c.Close()
+			pl.Put(c)
+			log.Logger.Errorf("%s: send error: %s, retry on another channel", p.model, err)
+			continue
+		}
+		pl.Put(c)
+		return nil
+	}
+}
+
+// declareOn 每个连接上只声明一次交换机/队列，断线重连后在新的连接上重新声明
+func (p *Producer) declareOn(c *pool.Channel, declare DeclareFunc) error {
+	p.declareMu.Lock()
+	defer p.declareMu.Unlock()
+	if p.declaredOn == c.Conn() {
+		return nil
+	}
+	if err := declare(c.Channel()); err != nil {
+		return err
+	}
+	p.declaredOn = c.Conn()
+	return nil
+}
+
+// confirmPooled 消息得到确认结果，在通信管道转发确认的协程中调用，不能阻塞
+func (p *Producer) confirmPooled(declare DeclareFunc, conf *confirmation, err error) {
+	switch err {
+	case nil:
+		p.finish(conf, nil)
+	case pool.ErrNacked:
+		log.Logger.Errorf("%s: nack message, body: %q", p.model, string(conf.msg.Body))
+		p.finish(conf, ErrNacked)
+	default:
+		go p.resendPooled(declare, conf)
+	}
+}
+
+// resendPooled 通信管道在确认前关闭，在另一个通信管道上重新发送，会话关闭时以ErrClosed结束
+func (p *Producer) resendPooled(declare DeclareFunc, conf *confirmation) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.session.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := p.sendPooled(ctx, declare, conf); err != nil {
+		if err == context.Canceled {
+			err = ErrClosed
+		}
+		log.Logger.Errorf("%s: resend error: %s", p.model, err)
+		p.finish(conf, err)
+	}
+}
+
+// returnPooled 将未被路由的消息交给NotifyReturn设置的回调
+func (p *Producer) returnPooled(msg external.XReturn) {
+	if handleFunc := p.returnHandler; handleFunc != nil {
+		handleFunc(msg)
+	}
+}
@@ -9,6 +9,7 @@
 package publish
 
 import (
+	"context"
 	"xrabbitmq/pkg/external"
 	"xrabbitmq/pkg/log"
 	"xrabbitmq/pkg/producer"
@@ -25,10 +26,23 @@ func New(sess *session.Session) *publish {
 
 func (p *publish) Publish(messages <-chan *external.XPublishMsg) (err error) {
 	defer p.Done(err)
+	return p.Producer.Publish(p.declare, messages)
+}
+
+func (p *publish) PublishWithConfirm(ctx context.Context, msg *external.XPublishMsg) (external.Confirmation, error) {
+	return p.Producer.PublishWithConfirm(ctx, p.declare, msg)
+}
+
+func (p *publish) PublishValue(ctx context.Context, v interface{}, opts ...external.PublishOption) (external.Confirmation, error) {
+	return p.Producer.PublishValue(ctx, p.declare, v, opts...)
+}
+
+// declare 声明交换机
+func (p *publish) declare(channel *external.XChannel) error {
 	// queueOptions := p.Sess().Queue()
 	exchangeOptions := p.Sess().Exchange()
 
-	err = p.Sess().Channel().ExchangeDeclare(
+	err := channel.ExchangeDeclare(
 		exchangeOptions.Name,
 		exchangeOptions.Typ,
 		exchangeOptions.Durable,
@@ -42,8 +56,5 @@ func (p *publish) Publish(messages <-chan *external.XPublishMsg) (err error) {
 		log.Logger.Errorf("%s.ExchangeDeclare error: %s", p.Model(), err)
 		return err
 	}
-
-	p.Producer.Publish(messages)
-
 	return nil
 }
@@ -12,6 +12,7 @@
 package routing
 
 import (
+	"context"
 	"xrabbitmq/pkg/external"
 	"xrabbitmq/pkg/log"
 	"xrabbitmq/pkg/producer"
@@ -32,10 +33,23 @@ func NewDynamic(sess *session.Session) *routing {
 
 func (p *routing) Publish(messages <-chan *external.XPublishMsg) (err error) {
 	defer p.Done(err)
+	return p.Producer.Publish(p.declare, messages)
+}
+
+func (p *routing) PublishWithConfirm(ctx context.Context, msg *external.XPublishMsg) (external.Confirmation, error) {
+	return p.Producer.PublishWithConfirm(ctx, p.declare, msg)
+}
+
+func (p *routing) PublishValue(ctx context.Context, v interface{}, opts ...external.PublishOption) (external.Confirmation, error) {
+	return p.Producer.PublishValue(ctx, p.declare, v, opts...)
+}
+
+// declare 声明交换机
+func (p *routing) declare(channel *external.XChannel) error {
 	// queueOptions := p.Sess().Queue()
 	exchangeOptions := p.Sess().Exchange()
 
-	err = p.Sess().Channel().ExchangeDeclare(
+	err := channel.ExchangeDeclare(
 		exchangeOptions.Name,
 		exchangeOptions.Typ,
 		exchangeOptions.Durable,
@@ -49,7 +63,5 @@ func (p *routing) Publish(messages <-chan *external.XPublishMsg) (err error) {
 		log.Logger.Errorf("%s.ExchangeDeclare error: %s", p.Model(), err)
 		return err
 	}
-
-	p.Producer.Publish(messages)
 	return nil
 }
@@ -9,6 +9,7 @@
 package simple
 
 import (
+	"context"
 	"xrabbitmq/pkg/external"
 	"xrabbitmq/pkg/log"
 	"xrabbitmq/pkg/producer"
@@ -25,9 +26,21 @@ func New(sess *session.Session) *simple {
 
 func (p *simple) Publish(messages <-chan *external.XPublishMsg) (err error) {
 	defer p.Done(err)
+	return p.Producer.Publish(p.declare, messages)
+}
+
+func (p *simple) PublishWithConfirm(ctx context.Context, msg *external.XPublishMsg) (external.Confirmation, error) {
+	return p.Producer.PublishWithConfirm(ctx, p.declare, msg)
+}
 
+func (p *simple) PublishValue(ctx context.Context, v interface{}, opts ...external.PublishOption) (external.Confirmation, error) {
+	return p.Producer.PublishValue(ctx, p.declare, v, opts...)
+}
+
+// declare 声明队列
+func (p *simple) declare(channel *external.XChannel) error {
 	queueOptions := p.Sess().Queue()
-	_, err = p.Sess().Channel().QueueDeclare(
+	_, err := channel.QueueDeclare(
 		queueOptions.Name,
 		queueOptions.Durable,
 		queueOptions.AutoDelete,
@@ -40,7 +53,5 @@ func (p *simple) Publish(messages <-chan *external.XPublishMsg) (err error) {
 		log.Logger.Errorf("%s.QueueDeclare error: %s", p.Model(), err)
 		return err
 	}
-
-	p.Producer.Publish(messages)
 	return nil
 }
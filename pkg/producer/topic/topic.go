@@ -11,6 +11,7 @@
 package topic
 
 import (
+	"context"
 	"xrabbitmq/pkg/external"
 	"xrabbitmq/pkg/log"
 	"xrabbitmq/pkg/producer"
@@ -31,10 +32,23 @@ func NewDynamic(sess *session.Session) *topic {
 
 func (p *topic) Publish(messages <-chan *external.XPublishMsg) (err error) {
 	defer p.Done(err)
+	return p.Producer.Publish(p.declare, messages)
+}
+
+func (p *topic) PublishWithConfirm(ctx context.Context, msg *external.XPublishMsg) (external.Confirmation, error) {
+	return p.Producer.PublishWithConfirm(ctx, p.declare, msg)
+}
+
+func (p *topic) PublishValue(ctx context.Context, v interface{}, opts ...external.PublishOption) (external.Confirmation, error) {
+	return p.Producer.PublishValue(ctx, p.declare, v, opts...)
+}
+
+// declare 声明交换机
+func (p *topic) declare(channel *external.XChannel) error {
 	// queueOptions := p.Sess().Queue()
 	exchangeOptions := p.Sess().Exchange()
 
-	err = p.Sess().Channel().ExchangeDeclare(
+	err := channel.ExchangeDeclare(
 		exchangeOptions.Name,
 		exchangeOptions.Typ,
 		exchangeOptions.Durable,
@@ -48,7 +62,5 @@ func (p *topic) Publish(messages <-chan *external.XPublishMsg) (err error) {
 		log.Logger.Errorf("%s.ExchangeDeclare error: %s", p.Model(), err)
 		return err
 	}
-
-	p.Producer.Publish(messages)
 	return nil
 }
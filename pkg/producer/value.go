@@ -0,0 +1,42 @@
+package producer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"xrabbitmq/pkg/codec"
+	"xrabbitmq/pkg/external"
+)
+
+// PublishValue 使用解码器编码v后发送，ContentType由解码器决定，返回的Confirmation在broker确认后完成
+// 开启了StampType时，会将v的类型名写入消息的Type属性
+func (p *Producer) PublishValue(ctx context.Context, declare DeclareFunc, v interface{}, opts ...external.PublishOption) (external.Confirmation, error) {
+	body, err := codec.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: marshal %T error: %w", p.model, v, err)
+	}
+
+	msg := &external.XPublishMsg{
+		ContentType: codec.ContentType(),
+		Body:        body,
+	}
+	if p.session.OptionsProducer().StampType {
+		msg.Type = typeName(v)
+	}
+	for _, o := range opts {
+		o(msg)
+	}
+	return p.PublishWithConfirm(ctx, declare, msg)
+}
+
+// typeName 得到值的类型名，指针取其指向的类型，如*orders.OrderCreated得到"orders.OrderCreated"
+func typeName(v interface{}) string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
@@ -0,0 +1,44 @@
+package producer
+
+import (
+	"context"
+	"testing"
+	"xrabbitmq/pkg/session"
+)
+
+type orderCreated struct {
+	ID int `json:"id"`
+}
+
+func TestTypeName(t *testing.T) {
+	order := &orderCreated{}
+	cases := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"struct", orderCreated{}, "producer.orderCreated"},
+		{"pointer", order, "producer.orderCreated"},
+		{"pointer to pointer", &order, "producer.orderCreated"},
+		{"builtin", "s", "string"},
+		{"map", map[string]int{}, "map[string]int"},
+		{"nil", nil, ""},
+	}
+	for _, c := range cases {
+		if got := typeName(c.v); got != c.want {
+			t.Errorf("%s: typeName = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPublishValueMarshalError(t *testing.T) {
+	p := NewProducer(session.NewSession(), ModelSimple)
+	conf, err := p.PublishValue(context.Background(), nil, make(chan int))
+	if conf != nil || err == nil {
+		t.Errorf("PublishValue = %v, %v, want marshal error", conf, err)
+	}
+	// 编码失败时不占用发送窗口
+	if n := len(p.window); n != 0 {
+		t.Errorf("window holds %d after marshal error", n)
+	}
+}
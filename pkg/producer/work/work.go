@@ -11,6 +11,7 @@
 package work
 
 import (
+	"context"
 	"xrabbitmq/pkg/external"
 	"xrabbitmq/pkg/log"
 	"xrabbitmq/pkg/producer"
@@ -27,9 +28,21 @@ func New(sess *session.Session) *work {
 
 func (p *work) Publish(messages <-chan *external.XPublishMsg) (err error) {
 	defer p.Done(err)
+	return p.Producer.Publish(p.declare, messages)
+}
+
+func (p *work) PublishWithConfirm(ctx context.Context, msg *external.XPublishMsg) (external.Confirmation, error) {
+	return p.Producer.PublishWithConfirm(ctx, p.declare, msg)
+}
+
+func (p *work) PublishValue(ctx context.Context, v interface{}, opts ...external.PublishOption) (external.Confirmation, error) {
+	return p.Producer.PublishValue(ctx, p.declare, v, opts...)
+}
 
+// declare 声明队列
+func (p *work) declare(channel *external.XChannel) error {
 	queueOptions := p.Sess().Queue()
-	_, err = p.Sess().Channel().QueueDeclare(
+	_, err := channel.QueueDeclare(
 		queueOptions.Name,
 		queueOptions.Durable,
 		queueOptions.AutoDelete,
@@ -41,6 +54,5 @@ func (p *work) Publish(messages <-chan *external.XPublishMsg) (err error) {
 		log.Logger.Errorf("%s.QueueDeclare error: %s", p.Model(), err)
 		return err
 	}
-	p.Producer.Publish(messages)
 	return nil
 }
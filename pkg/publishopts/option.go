@@ -0,0 +1,91 @@
+// 发送单条消息时的配置项，用于Producer.PublishValue
+package publishopts
+
+import (
+	"strconv"
+	"time"
+	"xrabbitmq/pkg/external"
+)
+
+type Option = external.PublishOption
+
+func SetRoutingKey(key string) Option {
+	return func(msg *external.XPublishMsg) {
+		msg.RoutingKey = key
+	}
+}
+
+// SetContentType 覆盖由解码器决定的ContentType
+func SetContentType(contentType string) Option {
+	return func(msg *external.XPublishMsg) {
+		msg.ContentType = contentType
+	}
+}
+
+func WithHeaders(headers external.XTable) Option {
+	return func(msg *external.XPublishMsg) {
+		if msg.Headers == nil {
+			msg.Headers = make(external.XTable)
+		}
+		for k, v := range headers {
+			msg.Headers[k] = v
+		}
+	}
+}
+
+// SetPersistent 消息持久化，需要队列也是持久化的
+func SetPersistent() Option {
+	return func(msg *external.XPublishMsg) {
+		msg.DeliveryMode = external.XPersistent
+	}
+}
+
+func SetPriority(priority uint8) Option {
+	return func(msg *external.XPublishMsg) {
+		msg.Priority = priority
+	}
+}
+
+func SetCorrelationId(id string) Option {
+	return func(msg *external.XPublishMsg) {
+		msg.CorrelationId = id
+	}
+}
+
+func SetReplyTo(replyTo string) Option {
+	return func(msg *external.XPublishMsg) {
+		msg.ReplyTo = replyTo
+	}
+}
+
+// SetExpiration 消息过期时间，精确到毫秒
+func SetExpiration(ttl time.Duration) Option {
+	return func(msg *external.XPublishMsg) {
+		msg.Expiration = strconv.FormatInt(int64(ttl/time.Millisecond), 10)
+	}
+}
+
+func SetMessageId(id string) Option {
+	return func(msg *external.XPublishMsg) {
+		msg.MessageId = id
+	}
+}
+
+func SetTimestamp(t time.Time) Option {
+	return func(msg *external.XPublishMsg) {
+		msg.Timestamp = t
+	}
+}
+
+// SetType 消息类型，消费者可据此选择解码的类型
+func SetType(typ string) Option {
+	return func(msg *external.XPublishMsg) {
+		msg.Type = typ
+	}
+}
+
+func SetAppId(appId string) Option {
+	return func(msg *external.XPublishMsg) {
+		msg.AppId = appId
+	}
+}
@@ -0,0 +1,81 @@
+package publishopts
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"xrabbitmq/pkg/external"
+)
+
+func TestOptions(t *testing.T) {
+	now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		msg  external.XPublishMsg
+		opts []Option
+		want external.XPublishing
+	}{
+		{
+			name: "properties",
+			msg:  external.XPublishMsg{ContentType: "application/json", Body: []byte("{}")},
+			opts: []Option{
+				SetPersistent(),
+				SetPriority(5),
+				SetCorrelationId("c-1"),
+				SetReplyTo("amq.rabbitmq.reply-to"),
+				SetExpiration(90 * time.Second),
+				SetMessageId("m-1"),
+				SetTimestamp(now),
+				SetType("orders.Created"),
+				SetAppId("orders"),
+			},
+			want: external.XPublishing{
+				ContentType:   "application/json",
+				DeliveryMode:  external.XPersistent,
+				Priority:      5,
+				CorrelationId: "c-1",
+				ReplyTo:       "amq.rabbitmq.reply-to",
+				Expiration:    "90000",
+				MessageId:     "m-1",
+				Timestamp:     now,
+				Type:          "orders.Created",
+				AppId:         "orders",
+				Body:          []byte("{}"),
+			},
+		},
+		{
+			name: "content type overridden",
+			msg:  external.XPublishMsg{ContentType: "application/json"},
+			opts: []Option{SetContentType("text/plain")},
+			want: external.XPublishing{ContentType: "text/plain"},
+		},
+		{
+			name: "headers merged",
+			msg:  external.XPublishMsg{Headers: external.XTable{"tenant": "a"}},
+			opts: []Option{WithHeaders(external.XTable{"region": "eu"}), WithHeaders(external.XTable{"tenant": "b"})},
+			want: external.XPublishing{Headers: external.XTable{"tenant": "b", "region": "eu"}},
+		},
+		{
+			name: "headers on empty message",
+			opts: []Option{WithHeaders(external.XTable{"tenant": "a"})},
+			want: external.XPublishing{Headers: external.XTable{"tenant": "a"}},
+		},
+	}
+	for _, c := range cases {
+		msg := c.msg
+		for _, o := range c.opts {
+			o(&msg)
+		}
+		if got := msg.Publishing(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: Publishing = %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSetRoutingKey(t *testing.T) {
+	msg := external.XPublishMsg{RoutingKey: "orders.created"}
+	SetRoutingKey("orders.deleted")(&msg)
+	if msg.RoutingKey != "orders.deleted" {
+		t.Errorf("RoutingKey = %q, want %q", msg.RoutingKey, "orders.deleted")
+	}
+}
@@ -0,0 +1,253 @@
+// 基于请求/响应的RPC
+// 客户端通过direct reply-to(amq.rabbitmq.reply-to)接收响应，无需声明响应队列；
+// 服务端基于消费者构建，处理请求后将结果发送到请求的ReplyTo
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/internal/utils"
+	"xrabbitmq/pkg/log"
+	"xrabbitmq/pkg/session"
+)
+
+// DirectReplyTo RabbitMQ提供的伪队列，在同一个通信管道上订阅后即可接收响应
+const DirectReplyTo = "amq.rabbitmq.reply-to"
+
+// ErrorHeader 服务端处理请求失败时，错误信息放在响应的该消息头中
+const ErrorHeader = "x-rpc-error"
+
+var (
+	// ErrClosed RPC客户端已关闭
+	ErrClosed = errors.New("rpc: client closed")
+
+	// ErrReplyLost 等待响应时通信管道被关闭，响应无法送达
+	ErrReplyLost = errors.New("rpc: channel closed before reply arrived")
+
+	// ErrNoRoute 请求无法被路由到任何队列
+	ErrNoRoute = errors.New("rpc: request returned by broker, no route to server")
+)
+
+// RemoteError 服务端处理请求时返回的错误
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "rpc: remote error: " + e.Message
+}
+
+// seq 用于生成进程内唯一的消费者标识及CorrelationId
+var seq uint64
+
+// reply 响应或等待响应时发生的错误
+type reply struct {
+	delivery external.XDelivery
+	err      error
+}
+
+// Client RPC客户端
+// 请求根据会话的交换机及队列名/RoutingKey路由到服务端
+type Client struct {
+	session *session.Session
+
+	// tag 订阅DirectReplyTo的消费者标识
+	tag string
+
+	mu sync.Mutex
+
+	// channel 订阅了DirectReplyTo的通信管道，请求必须在该通信管道上发送
+	channel *external.XChannel
+
+	// pending 等待响应的请求，以CorrelationId为key
+	pending map[string]chan reply
+
+	// inflight 等待响应的请求数
+	inflight utils.Counter
+}
+
+// NewClient 在已建立通信管道的会话上创建RPC客户端
+func NewClient(sess *session.Session) (*Client, error) {
+	c := &Client{
+		session: sess,
+		tag:     fmt.Sprintf("xrabbitmq-rpc-%d-%d", os.Getpid(), atomic.AddUint64(&seq, 1)),
+		pending: make(map[string]chan reply),
+	}
+	channel := sess.Channel()
+	replies, returns, err := c.subscribe(channel)
+	if err != nil {
+		return nil, err
+	}
+	go c.listen(channel, replies, returns)
+	return c, nil
+}
+
+func (c *Client) Sess() *session.Session {
+	return c.session
+}
+
+// Call 发送请求并等待响应，ctx到期时放弃等待
+// msg的CorrelationId/ReplyTo由客户端设置；未设置Expiration时，ctx的剩余时间会作为请求的过期时间
+// 服务端处理失败时返回*RemoteError
+func (c *Client) Call(ctx context.Context, msg *external.XPublishMsg) (external.XDelivery, error) {
+	c.inflight.Add(1)
+	defer c.inflight.Done()
+
+	request := *msg
+	request.CorrelationId = strconv.FormatUint(atomic.AddUint64(&seq, 1), 36)
+	request.ReplyTo = DirectReplyTo
+	if dl, ok := ctx.Deadline(); ok && request.Expiration == "" {
+		if ttl := time.Until(dl) / time.Millisecond; ttl > 0 {
+			request.Expiration = strconv.FormatInt(int64(ttl), 10)
+		}
+	}
+
+	replyChan := make(chan reply, 1)
+	c.mu.Lock()
+	if c.pending == nil {
+		c.mu.Unlock()
+		return external.XDelivery{}, ErrClosed
+	}
+	c.pending[request.CorrelationId] = replyChan
+	channel := c.channel
+	c.mu.Unlock()
+	defer c.forget(request.CorrelationId)
+
+	key := request.RoutingKey
+	if key == "" {
+		key = c.session.Queue().Name
+	}
+	if err := channel.Publish(c.session.Exchange().Name, key, true, false, request.Publishing()); err != nil {
+		return external.XDelivery{}, fmt.Errorf("rpc call error: %w", err)
+	}
+
+	select {
+	case r := <-replyChan:
+		return r.delivery, r.err
+	case <-ctx.Done():
+		return external.XDelivery{}, ctx.Err()
+	}
+}
+
+// Drain 等待所有请求得到响应后关闭会话
+func (c *Client) Drain(ctx context.Context) error {
+	if err := c.inflight.Wait(ctx); err != nil {
+		return fmt.Errorf("rpc client abandoned %d calls: %w", c.inflight.Count(), err)
+	}
+	c.session.Close()
+	return nil
+}
+
+// Cancel 关闭通信管道，释放资源，等待响应的请求以ErrClosed结束
+func (c *Client) Cancel() error {
+	return c.session.Release(c.tag)
+}
+
+// subscribe 在通信管道上订阅DirectReplyTo，并监听被退回的请求
+func (c *Client) subscribe(channel *external.XChannel) (<-chan external.XDelivery, chan external.XReturn, error) {
+	replies, err := channel.Consume(DirectReplyTo, c.tag, true, false, false, false, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rpc subscribe %s error: %w", DirectReplyTo, err)
+	}
+	returns := c.session.NotifyReturn(make(chan external.XReturn, 1))
+
+	c.mu.Lock()
+	c.channel = channel
+	c.mu.Unlock()
+	return replies, returns, nil
+}
+
+// listen 将响应及被退回的请求分发给等待的请求，通信管道重建后重新订阅
+func (c *Client) listen(channel *external.XChannel, replies <-chan external.XDelivery, returns chan external.XReturn) {
+	defer func() {
+		if x := recover(); x != nil {
+			log.Logger.Errorf("rpc client listen panic: %+v", x)
+		}
+	}()
+
+	for {
+		select {
+		case d, ok := <-replies:
+			if ok {
+				r := reply{delivery: d}
+				if msg, ok := d.Headers[ErrorHeader].(string); ok {
+					r.err = &RemoteError{Message: msg}
+				}
+				c.resolve(d.CorrelationId, r)
+				continue
+			}
+			// 通信管道已关闭，旧通信管道上的请求无法再收到响应
+			c.failAll(ErrReplyLost)
+			for {
+				var recovered bool
+				if channel, recovered = c.session.WaitRecovered(channel); !recovered {
+					c.close()
+					return
+				}
+				var err error
+				if replies, returns, err = c.subscribe(channel); err == nil {
+					break
+				}
+				log.Logger.Errorf("%s", err)
+			}
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.resolve(r.CorrelationId, reply{err: ErrNoRoute})
+		case <-c.session.Done():
+			c.close()
+			return
+		}
+	}
+}
+
+// resolve 将响应交给等待的请求
+func (c *Client) resolve(id string, r reply) {
+	c.mu.Lock()
+	replyChan, ok := c.pending[id]
+	delete(c.pending, id)
+	c.mu.Unlock()
+	if ok {
+		replyChan <- r
+	}
+}
+
+// forget 请求不再等待响应
+func (c *Client) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+// failAll 所有等待响应的请求以err结束
+func (c *Client) failAll(err error) {
+	c.mu.Lock()
+	pending := c.pending
+	if pending != nil {
+		c.pending = make(map[string]chan reply)
+	}
+	c.mu.Unlock()
+	for _, replyChan := range pending {
+		replyChan <- reply{err: err}
+	}
+}
+
+// close 会话关闭后，等待响应的请求以ErrClosed结束，不再接受新的请求
+func (c *Client) close() {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	for _, replyChan := range pending {
+		replyChan <- reply{err: ErrClosed}
+	}
+}
@@ -0,0 +1,100 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+)
+
+// waiting 像Call一样登记等待响应的请求
+func waiting(c *Client, ids ...string) map[string]chan reply {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	replies := make(map[string]chan reply, len(ids))
+	for _, id := range ids {
+		replies[id] = make(chan reply, 1)
+		c.pending[id] = replies[id]
+	}
+	return replies
+}
+
+func TestClientListen(t *testing.T) {
+	c := &Client{session: session.NewSession(), pending: make(map[string]chan reply)}
+	calls := waiting(c, "ok", "failed", "returned", "unanswered")
+
+	replies := make(chan external.XDelivery)
+	returns := make(chan external.XReturn)
+	done := make(chan struct{})
+	go func() {
+		c.listen(nil, replies, returns)
+		close(done)
+	}()
+	replies <- external.XDelivery{CorrelationId: "ok", Body: []byte("pong")}
+	replies <- external.XDelivery{CorrelationId: "failed", Headers: external.XTable{ErrorHeader: "boom"}}
+	returns <- external.XReturn{CorrelationId: "returned"}
+	// 未知的响应被忽略
+	replies <- external.XDelivery{CorrelationId: "unknown"}
+	c.session.Close()
+	<-done
+
+	cases := []struct {
+		id   string
+		body string
+		err  error
+	}{
+		{"ok", "pong", nil},
+		{"failed", "", &RemoteError{Message: "boom"}},
+		{"returned", "", ErrNoRoute},
+		{"unanswered", "", ErrClosed},
+	}
+	for _, cs := range cases {
+		r := <-calls[cs.id]
+		if string(r.delivery.Body) != cs.body {
+			t.Errorf("%s: body = %q, want %q", cs.id, r.delivery.Body, cs.body)
+		}
+		var remote *RemoteError
+		switch {
+		case errors.As(cs.err, &remote):
+			if got, ok := r.err.(*RemoteError); !ok || got.Message != remote.Message {
+				t.Errorf("%s: err = %v, want %v", cs.id, r.err, cs.err)
+			}
+		case r.err != cs.err:
+			t.Errorf("%s: err = %v, want %v", cs.id, r.err, cs.err)
+		}
+	}
+
+	// 关闭后不再接受新的请求
+	if _, err := c.Call(context.Background(), &external.XPublishMsg{}); err != ErrClosed {
+		t.Errorf("Call after close = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestClientReplyLost(t *testing.T) {
+	c := &Client{session: session.NewSession(), pending: make(map[string]chan reply)}
+	calls := waiting(c, "a", "b")
+
+	replies := make(chan external.XDelivery)
+	done := make(chan struct{})
+	go func() {
+		c.listen(nil, replies, nil)
+		close(done)
+	}()
+	// 通信管道关闭，等待中的请求无法再收到响应
+	close(replies)
+	for id, call := range calls {
+		if r := <-call; r.err != ErrReplyLost {
+			t.Errorf("%s: err = %v, want %v", id, r.err, ErrReplyLost)
+		}
+	}
+
+	// 会话没有恢复就被关闭
+	c.session.Close()
+	<-done
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending != nil {
+		t.Error("client still accepts calls after session closed")
+	}
+}
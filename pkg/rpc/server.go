@@ -0,0 +1,64 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+)
+
+// HandleFunc 处理请求并返回响应，返回错误时错误信息会作为响应发送给客户端
+type HandleFunc func(ctx context.Context, request external.XDelivery) (*external.XPublishMsg, error)
+
+// Server RPC服务端，基于消费者构建
+type Server struct {
+	consumer external.Consumer
+
+	session *session.Session
+}
+
+// NewServer 基于通过ConsumerBuilder构建的消费者(一般为Simple/Work模式)创建RPC服务端
+func NewServer(c external.Consumer) (*Server, error) {
+	s, ok := c.(interface{ Sess() *session.Session })
+	if !ok {
+		return nil, fmt.Errorf("rpc: consumer %T is not built by ConsumerBuilder", c)
+	}
+	return &Server{consumer: c, session: s.Sess()}, nil
+}
+
+// Serve 开始处理请求，阻塞式
+// 响应被发送到请求的ReplyTo后确认请求；没有ReplyTo的请求只被处理，不发送响应
+// 响应发送失败时请求按照消费者配置的策略被拒绝
+func (s *Server) Serve(handler HandleFunc) error {
+	return s.consumer.ConsumeFunc(func(ctx context.Context, request external.XDelivery) error {
+		response, err := handler(ctx, request)
+		if request.ReplyTo == "" {
+			return err
+		}
+
+		if response == nil {
+			response = &external.XPublishMsg{}
+		}
+		msg := response.Publishing()
+		msg.CorrelationId = request.CorrelationId
+		if err != nil {
+			headers := make(external.XTable, len(msg.Headers)+1)
+			for k, v := range msg.Headers {
+				headers[k] = v
+			}
+			headers[ErrorHeader] = err.Error()
+			msg.Headers = headers
+		}
+
+		// 响应经默认交换机发送到请求的ReplyTo
+		if err := s.session.Channel().Publish("", request.ReplyTo, false, false, msg); err != nil {
+			return fmt.Errorf("rpc reply error: %w", err)
+		}
+		return nil
+	})
+}
+
+// Cancel 关闭通信管道，释放资源
+func (s *Server) Cancel() error {
+	return s.consumer.Cancel()
+}
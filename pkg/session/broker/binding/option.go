@@ -8,6 +8,9 @@ type Option func(*Binding)
 
 // 绑定选项
 type Binding struct {
+	// Exchange: 绑定的交换机，为空时为会话的交换机
+	Exchange string
+
 	// RoutingKey: 使用匹配的路由键将消息发布到给定队列——每个队列都有一个默认绑定到默认交换器，
 	// 使用它们的队列名称，这样就可以通过默认交换器将消息发送到队列
 	RoutingKey string
@@ -19,6 +22,21 @@ type Binding struct {
 	Args external.XTable
 }
 
+func SetExchange(name string) Option {
+	return func(options *Binding) {
+		options.Exchange = name
+	}
+}
+
+// New 创建一个绑定，exchange为空时绑定到会话的交换机
+func New(exchange, key string, args external.XTable) Binding {
+	return Binding{
+		Exchange:   exchange,
+		RoutingKey: key,
+		Args:       args,
+	}
+}
+
 func SetRoutingKey(key string) Option {
 	return func(options *Binding) {
 		options.RoutingKey = key
@@ -31,6 +49,21 @@ func SetNoWait(noWait bool) Option {
 	}
 }
 
+// SetMatchAll headers交换机，消息头需要匹配所有的键值对
+func SetMatchAll() Option {
+	return WithArgs(external.XTable{"x-match": "all"})
+}
+
+// SetMatchAny headers交换机，消息头匹配任意一个键值对即可
+func SetMatchAny() Option {
+	return WithArgs(external.XTable{"x-match": "any"})
+}
+
+// WithHeaders headers交换机，要匹配的消息头键值对
+func WithHeaders(headers external.XTable) Option {
+	return WithArgs(headers)
+}
+
 func WithArgs(args external.XTable) Option {
 	return func(options *Binding) {
 		if options.Args == nil {
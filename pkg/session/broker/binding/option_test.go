@@ -0,0 +1,39 @@
+package binding
+
+import (
+	"reflect"
+	"testing"
+	"xrabbitmq/pkg/external"
+)
+
+func TestHeadersOptions(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []Option
+		want external.XTable
+	}{
+		{"none", nil, nil},
+		{"match all", []Option{SetMatchAll(), WithHeaders(external.XTable{"tenant": "a"})}, external.XTable{"x-match": "all", "tenant": "a"}},
+		{"match any", []Option{WithHeaders(external.XTable{"tenant": "a", "region": "eu"}), SetMatchAny()}, external.XTable{"x-match": "any", "tenant": "a", "region": "eu"}},
+		{"later wins", []Option{SetMatchAll(), SetMatchAny(), WithHeaders(external.XTable{"tenant": "a"}), WithHeaders(external.XTable{"tenant": "b"})}, external.XTable{"x-match": "any", "tenant": "b"}},
+	}
+	for _, c := range cases {
+		var b Binding
+		for _, o := range c.opts {
+			o(&b)
+		}
+		if !reflect.DeepEqual(b.Args, c.want) {
+			t.Errorf("%s: Args = %v, want %v", c.name, b.Args, c.want)
+		}
+	}
+}
+
+func TestWithArgsCopies(t *testing.T) {
+	headers := external.XTable{"tenant": "a"}
+	var b Binding
+	WithHeaders(headers)(&b)
+	SetMatchAll()(&b)
+	if _, ok := headers["x-match"]; ok {
+		t.Error("binding options modified the caller's headers")
+	}
+}
@@ -16,6 +16,25 @@ type Broker struct {
 	queue.Queue
 	// 绑定
 	binding.Binding
+
+	// 额外的绑定，与Binding一起声明
+	Bindings []binding.Binding
+
+	// 死信
+	DeadLetter DeadLetter
+}
+
+// DeadLetter 队列的死信交换机及死信队列
+// 被拒绝且不重新入队、过期或超过队列长度的消息会经死信交换机投递到死信队列
+type DeadLetter struct {
+	// Enabled 是否为队列配置死信
+	Enabled bool
+
+	// Exchange 死信交换机(direct)，为空时为"<队列名>.dlx"
+	Exchange string
+
+	// Queue 死信队列，为空时为"<队列名>.dlq"
+	Queue string
 }
 
 func WithExchange(eos ...exchange.Option) Option {
@@ -53,6 +72,26 @@ func WithQueue(qos ...queue.Option) Option {
 	}
 }
 
+// WithDeadLetter 为消费的队列声明死信交换机及死信队列，并在队列的Args中设置
+// x-dead-letter-exchange/x-dead-letter-routing-key；名字为空时根据队列名生成
+func WithDeadLetter(exchange, queue string) Option {
+	return func(broker *Broker) {
+		broker.DeadLetter = DeadLetter{
+			Enabled:  true,
+			Exchange: exchange,
+			Queue:    queue,
+		}
+	}
+}
+
+// WithBindings 将消费的队列同时绑定到多个RoutingKey或交换机
+// 会话的交换机之外的交换机不会被声明，需要事先存在
+func WithBindings(bindings ...binding.Binding) Option {
+	return func(broker *Broker) {
+		broker.Bindings = append(broker.Bindings, bindings...)
+	}
+}
+
 func WithBinding(bos ...binding.Option) Option {
 	return func(broker *Broker) {
 		// bo := binding.Binding{
@@ -1,6 +1,8 @@
 package queue
 
 import (
+	"fmt"
+	"time"
 	"xrabbitmq/pkg/external"
 )
 
@@ -81,3 +83,13 @@ func WithArgs(args external.XTable) Option {
 		}
 	}
 }
+
+// RetryName 得到队列name等待delay后重试的延迟队列名
+func RetryName(name string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", name, delay)
+}
+
+// DeadLetterName 得到队列name的死信队列名，重试次数用尽或被拒绝的消息停放在这里
+func DeadLetterName(name string) string {
+	return name + ".dlq"
+}
@@ -1,6 +1,9 @@
 package consumeropts
 
 import (
+	"errors"
+	"fmt"
+	"time"
 	"xrabbitmq/pkg/external"
 )
 
@@ -25,8 +28,104 @@ type Options struct {
 
 	// Args: 额外的属性
 	Args external.XTable
+
+	// PoisonHandler: ConsumeTyped解码失败的消息交给它处理，未设置时拒绝该消息且不重新入队，
+	// 队列配置了死信交换机时消息会被投递到死信队列
+	PoisonHandler PoisonFunc
+
+	// ErrorAction: handler返回错误时对消息的处理，未设置时重新入队
+	ErrorAction Action
+
+	// PanicAction: handler panic时对消息的处理，未设置时拒绝且不重新入队，避免消息反复导致panic
+	PanicAction Action
+
+	// ErrorRules: 按照错误选择对消息的处理，依次匹配，都不匹配时使用ErrorAction
+	ErrorRules []ErrorRule
+
+	// Concurrency: 同时处理消息的goroutine数，不大于1时逐条处理
+	// 预取数量(Qos)不小于该值，未通过Qos设置时等于该值
+	Concurrency int
+
+	// OrderingKey: 并发处理时，得到相同key的消息由同一个goroutine按照接收顺序处理
+	// 未设置时消息被任意空闲的goroutine处理，不保证顺序
+	OrderingKey KeyFunc
+
+	// RetryDelays: 配置后，handler返回的错误需要重新入队时，消息会被延迟重新投递：
+	// 第n次重试的消息被发送到等待RetryDelays[n-1]的延迟队列(超过长度时使用最后一个)，过期后回到原队列
+	// 重试消息在专用的通信管道上发送，被broker确认后才确认原消息，发送失败时原消息重新入队；
+	// 要求指定队列名，Publish/Routing/Topic/Headers等使用服务端命名队列的消费者配置后会在建立时返回错误
+	RetryDelays []time.Duration
+
+	// RetryMaxAttempts: 最多重试的次数，超过后消息被停放到死信队列，不大于0时为len(RetryDelays)
+	RetryMaxAttempts int
+}
+
+// DefaultRetryDelays 默认的重试延迟
+var DefaultRetryDelays = []time.Duration{time.Second, time.Second * 10, time.Minute}
+
+// KeyFunc 得到消息的排序key
+type KeyFunc func(delivery external.XDelivery) string
+
+// Action 非自动确认时，handler处理完消息后对消息的处理
+type Action int
+
+const (
+	// ActionDefault 使用默认的处理
+	ActionDefault Action = iota
+	// ActionAck 确认消息
+	ActionAck
+	// ActionRequeue 拒绝消息并重新入队
+	ActionRequeue
+	// ActionReject 拒绝消息且不重新入队，队列配置了死信交换机时消息会被投递到死信队列
+	ActionReject
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionAck:
+		return "ack"
+	case ActionRequeue:
+		return "requeue"
+	case ActionReject:
+		return "reject"
+	default:
+		return "default"
+	}
 }
 
+// ErrorRule 匹配到错误时对消息的处理
+type ErrorRule struct {
+	Match  func(err error) bool
+	Action Action
+}
+
+// ActionFor 得到handler返回err时对消息的处理
+func (o Options) ActionFor(err error) Action {
+	if err == nil {
+		return ActionAck
+	}
+	for _, rule := range o.ErrorRules {
+		if rule.Match(err) && rule.Action != ActionDefault {
+			return rule.Action
+		}
+	}
+	if o.ErrorAction != ActionDefault {
+		return o.ErrorAction
+	}
+	return ActionRequeue
+}
+
+// ActionForPanic 得到handler panic时对消息的处理
+func (o Options) ActionForPanic() Action {
+	if o.PanicAction != ActionDefault {
+		return o.PanicAction
+	}
+	return ActionReject
+}
+
+// PoisonFunc 处理无法解码的消息，err为解码失败的原因；非自动确认时需要自行确认或拒绝该消息
+type PoisonFunc func(delivery external.XDelivery, err error)
+
 func SetTag(tag string) Option {
 	return func(options *Options) {
 		options.Tag = tag
@@ -57,6 +156,81 @@ func SetNoWait(noWait bool) Option {
 	}
 }
 
+func SetPoisonHandler(handler PoisonFunc) Option {
+	return func(options *Options) {
+		options.PoisonHandler = handler
+	}
+}
+
+func SetErrorAction(action Action) Option {
+	return func(options *Options) {
+		options.ErrorAction = action
+	}
+}
+
+func SetPanicAction(action Action) Option {
+	return func(options *Options) {
+		options.PanicAction = action
+	}
+}
+
+// WithErrorRule handler返回的错误满足errors.Is(err, target)时按照action处理消息
+func WithErrorRule(target error, action Action) Option {
+	return WithErrorMatch(func(err error) bool {
+		return errors.Is(err, target)
+	}, action)
+}
+
+// WithErrorMatch handler返回的错误满足match时按照action处理消息，可用于按照错误类型匹配
+func WithErrorMatch(match func(err error) bool, action Action) Option {
+	return func(options *Options) {
+		options.ErrorRules = append(options.ErrorRules, ErrorRule{Match: match, Action: action})
+	}
+}
+
+// WithRetry 开启延迟重试，delays为空时使用DefaultRetryDelays
+// 只适用于指定了队列名的消费者，Publish/Routing/Topic/Headers消费者(服务端命名的队列)会被拒绝
+func WithRetry(maxAttempts int, delays ...time.Duration) Option {
+	return func(options *Options) {
+		if len(delays) == 0 {
+			delays = DefaultRetryDelays
+		}
+		options.RetryDelays = append([]time.Duration(nil), delays...)
+		options.RetryMaxAttempts = maxAttempts
+	}
+}
+
+// SetConcurrency 设置同时处理消息的goroutine数
+func SetConcurrency(n int) Option {
+	return func(options *Options) {
+		options.Concurrency = n
+	}
+}
+
+// SetOrderingKey 并发处理时，key相同的消息保持接收顺序
+func SetOrderingKey(key KeyFunc) Option {
+	return func(options *Options) {
+		options.OrderingKey = key
+	}
+}
+
+// OrderByRoutingKey 并发处理时，RoutingKey相同的消息保持接收顺序
+func OrderByRoutingKey() Option {
+	return SetOrderingKey(func(delivery external.XDelivery) string {
+		return delivery.RoutingKey
+	})
+}
+
+// OrderByHeader 并发处理时，消息头name的值相同的消息保持接收顺序
+func OrderByHeader(name string) Option {
+	return SetOrderingKey(func(delivery external.XDelivery) string {
+		if v, ok := delivery.Headers[name]; ok {
+			return fmt.Sprint(v)
+		}
+		return ""
+	})
+}
+
 func WithArgs(args external.XTable) Option {
 	return func(options *Options) {
 		if options.Args == nil {
@@ -0,0 +1,58 @@
+package consumeropts
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestActionFor(t *testing.T) {
+	errInvalid := errors.New("invalid")
+	errTemporary := errors.New("temporary")
+	cases := []struct {
+		name string
+		opts []Option
+		err  error
+		want Action
+	}{
+		{"nil error acked", nil, nil, ActionAck},
+		{"nil error acked despite error action", []Option{SetErrorAction(ActionReject)}, nil, ActionAck},
+		{"requeue by default", nil, errInvalid, ActionRequeue},
+		{"error action", []Option{SetErrorAction(ActionReject)}, errInvalid, ActionReject},
+		{"rule matches wrapped error", []Option{WithErrorRule(errInvalid, ActionReject)}, fmt.Errorf("decode: %w", errInvalid), ActionReject},
+		{"rule not matched", []Option{WithErrorRule(errInvalid, ActionReject), SetErrorAction(ActionAck)}, errTemporary, ActionAck},
+		{"first matching rule wins", []Option{WithErrorRule(errInvalid, ActionAck), WithErrorRule(errInvalid, ActionReject)}, errInvalid, ActionAck},
+		{"default rule skipped", []Option{WithErrorRule(errInvalid, ActionDefault), WithErrorRule(errInvalid, ActionReject)}, errInvalid, ActionReject},
+		{"match func", []Option{WithErrorMatch(func(err error) bool { return err == errTemporary }, ActionRequeue), SetErrorAction(ActionReject)}, errTemporary, ActionRequeue},
+	}
+	for _, c := range cases {
+		var o Options
+		for _, opt := range c.opts {
+			opt(&o)
+		}
+		if got := o.ActionFor(c.err); got != c.want {
+			t.Errorf("%s: ActionFor(%v) = %s, want %s", c.name, c.err, got, c.want)
+		}
+	}
+}
+
+func TestActionForPanic(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []Option
+		want Action
+	}{
+		{"reject by default", nil, ActionReject},
+		{"panic action", []Option{SetPanicAction(ActionRequeue)}, ActionRequeue},
+		{"error action ignored", []Option{SetErrorAction(ActionAck)}, ActionReject},
+	}
+	for _, c := range cases {
+		var o Options
+		for _, opt := range c.opts {
+			opt(&o)
+		}
+		if got := o.ActionForPanic(); got != c.want {
+			t.Errorf("%s: ActionForPanic = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package produceropts
 
 type Option = func(*Options)
 
+// DefaultMaxOutstanding 默认最多同时等待broker确认的消息数
+const DefaultMaxOutstanding = 256
+
 type Options struct {
 	// RoutingKey: 使用匹配的路由键将消息发布到给定队列——每个队列都有一个默认绑定到默认交换器，
 	// 使用它们的队列名称，这样就可以通过默认交换器将消息发送到队列
@@ -10,6 +13,14 @@ type Options struct {
 	// Tag:  tag
 	Tag string
 
+	// MaxOutstanding: 最多同时等待broker确认的消息数，达到上限后发送新的消息会阻塞，直到有消息被确认
+	// 不大于0时使用DefaultMaxOutstanding；为1时每条消息都要等到被确认后才会发送下一条
+	MaxOutstanding int
+
+	// StampType: PublishValue发送消息时，是否将值的类型名(如"orders.OrderCreated")写入消息的Type属性，
+	// 便于消费者据此选择解码的类型；通过publishopts.SetType设置了Type时以设置的为准
+	StampType bool
+
 	// 概括来说:
 	//	1. mandatory标志告诉服务器至少将该消息route到一个队列中，否则将消息返还给生产者
 	//
@@ -60,6 +71,18 @@ func SetTag(tag string) Option {
 	}
 }
 
+func SetMaxOutstanding(n int) Option {
+	return func(options *Options) {
+		options.MaxOutstanding = n
+	}
+}
+
+func SetStampType(stamp bool) Option {
+	return func(options *Options) {
+		options.StampType = stamp
+	}
+}
+
 func SetMandatory(mandatory bool) Option {
 	return func(options *Options) {
 		options.Mandatory = mandatory
@@ -3,7 +3,11 @@ package session
 
 import (
 	"fmt"
+	"sync"
 	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/internal/utils"
+	"xrabbitmq/pkg/log"
+	"xrabbitmq/pkg/pool"
 	"xrabbitmq/pkg/session/broker"
 	"xrabbitmq/pkg/session/broker/binding"
 	"xrabbitmq/pkg/session/broker/exchange"
@@ -19,10 +23,28 @@ type Option func(session *Session)
 // 可以抽象的认定为是当前生产者/消费者与RabbitMQ之间的一个会话，虽然RabbitMQ的
 // 架构模型中并没有这层概念
 type Session struct {
+	// mu 保护channel/recovered/closed，断线重连后通信管道会被替换
+	mu sync.RWMutex
+
 	// channel 生产者/消费者基于上层与RabbitMQ建立的连接(amqp.Connection)在此连接上开辟出来的一条通信管道
 	// 对于操作系统而言，建立连接是很消耗资源的。相比而言，基于一条连接开辟多条通信管道是更加高效、轻量的方式
 	channel *external.XChannel
 
+	// conn 通信管道所在的连接，用于开辟临时的通信管道，断线重连后会被替换
+	conn *external.XConnection
+
+	// recovered 每次通信管道重建后会被关闭并替换，用于唤醒等待会话恢复的生产者/消费者
+	recovered chan struct{}
+
+	// closed 会话是否已关闭，关闭后不再重建通信管道
+	closed bool
+
+	// done 会话关闭时关闭
+	done chan struct{}
+
+	// pool 通信管道池，设置时会话不占用通信管道，生产者每次发送时从池中借出
+	pool *pool.Pool
+
 	// Broker 是RabbitMQ架构模型中的中介模块
 	// 它包含了交换机、队列、binding。 更多关于broker的知识可以上网查询
 	broker broker.Broker
@@ -40,13 +62,159 @@ func (s *Session) Establish(conn *external.XConnection) error {
 	if err != nil {
 		return fmt.Errorf("session establish error: get channel by connection error: %s", err)
 	}
-	s.channel = channel
+	s.mu.Lock()
+	s.conn, s.channel = conn, channel
+	s.mu.Unlock()
+	go s.watch(conn, channel)
+	return nil
+}
+
+// EstablishFrom 使用通信管道池，会话本身不占用通信管道
+// 生产者每次发送时从池中借出通信管道，发送后立即归还
+func (s *Session) EstablishFrom(p *pool.Pool) error {
+	s.mu.Lock()
+	s.pool = p
+	s.mu.Unlock()
 	return nil
 }
 
+// Pool 得到会话使用的通信管道池，未使用时为nil
+func (s *Session) Pool() *pool.Pool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pool
+}
+
 // HasEstablished 是否建立了通信管道
 func (s *Session) HasEstablished() bool {
-	return s.channel != nil
+	return s.Channel() != nil
+}
+
+// Pooled 是否使用通信管道池
+func (s *Session) Pooled() bool {
+	return s.Pool() != nil
+}
+
+// Recover 在(新的)连接上重建通信管道，并唤醒所有等待会话恢复的生产者/消费者
+// 交换机/队列/binding的重新声明由生产者/消费者在被唤醒后自行完成
+// 使用通信管道池的会话没有自己的通信管道，只唤醒等待者，由它们重新从池中借出
+func (s *Session) Recover(conn *external.XConnection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	if s.pool != nil {
+		close(s.recovered)
+		s.recovered = make(chan struct{})
+		return nil
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("session recover error: get channel by connection error: %s", err)
+	}
+	s.conn, s.channel = conn, channel
+	close(s.recovered)
+	s.recovered = make(chan struct{})
+	go s.watch(conn, channel)
+	return nil
+}
+
+// WaitRecovered 阻塞等待会话在old之外重建出新的通信管道
+// 会话关闭时返回false
+func (s *Session) WaitRecovered(old *external.XChannel) (*external.XChannel, bool) {
+	for {
+		s.mu.RLock()
+		closed, channel, recovered := s.closed, s.channel, s.recovered
+		s.mu.RUnlock()
+		if closed {
+			return nil, false
+		}
+		if channel != old {
+			return channel, true
+		}
+		<-recovered
+	}
+}
+
+// Recovered 会话下一次恢复或关闭时被关闭
+func (s *Session) Recovered() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.recovered
+}
+
+// Close 关闭会话，不再重建通信管道，同时唤醒所有等待会话恢复的生产者/消费者
+// 不会关闭通信管道本身，一般在RabbitMQ客户端关闭时使用
+func (s *Session) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.recovered)
+	close(s.done)
+}
+
+// Done 会话关闭时被关闭
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Closed 会话是否已关闭
+func (s *Session) Closed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.closed
+}
+
+// Release 关闭会话并释放它所占用的通信管道
+// 使用通信管道池的会话不占用通信管道，只关闭会话
+func (s *Session) Release(tag string) error {
+	s.Close()
+	if s.Pooled() {
+		return nil
+	}
+	return utils.CancelChannel(s.Channel(), tag)
+}
+
+// NotifyPublish 在当前的通信管道上监听消息确认，同amqp.Channel.NotifyPublish
+// 使用通信管道池的会话没有自己的通信管道，receiver会被直接关闭
+func (s *Session) NotifyPublish(receiver chan external.XConfirmation) chan external.XConfirmation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.channel == nil {
+		close(receiver)
+		return receiver
+	}
+	return s.channel.NotifyPublish(receiver)
+}
+
+// NotifyReturn 在当前的通信管道上监听未被路由的消息，同amqp.Channel.NotifyReturn
+// 使用通信管道池的会话没有自己的通信管道，receiver会被直接关闭
+func (s *Session) NotifyReturn(receiver chan external.XReturn) chan external.XReturn {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.channel == nil {
+		close(receiver)
+		return receiver
+	}
+	return s.channel.NotifyReturn(receiver)
+}
+
+// watch 监听通信管道的异常关闭
+// 连接仍然可用时(例如channel级别的异常)，直接在原连接上重建通信管道；
+// 连接断开的情况交由RabbitMQ客户端在重连后统一恢复
+func (s *Session) watch(conn *external.XConnection, channel *external.XChannel) {
+	xerr, ok := <-channel.NotifyClose(make(chan *external.XError, 1))
+	if !ok || conn.IsClosed() {
+		return
+	}
+	log.Logger.Warningf("session channel closed: %s, try to recover...", xerr)
+	if err := s.Recover(conn); err != nil {
+		log.Logger.Errorf("%s", err)
+	}
 }
 
 // NewSession 传入各种配置项，得到一个未建立通信管道的会话实例
@@ -56,6 +224,8 @@ func (s *Session) HasEstablished() bool {
 func NewSession(opts ...Option) *Session {
 	s := Session{
 		channel:         nil,
+		recovered:       make(chan struct{}),
+		done:            make(chan struct{}),
 		broker:          broker.Broker{},
 		consumerOptions: consumeropts.Options{},
 		producerOptions: produceropts.Options{},
@@ -68,17 +238,59 @@ func NewSession(opts ...Option) *Session {
 
 // Channel get current session‘s channel
 func (s *Session) Channel() *external.XChannel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.channel
 }
 
+// Conn 得到会话的通信管道所在的连接，用于开辟临时的通信管道
+// 使用通信管道池或尚未建立通信管道时为nil
+func (s *Session) Conn() *external.XConnection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.conn
+}
+
 // Exchange get exchange setting
 func (s *Session) Exchange() exchange.Exchange {
 	return s.broker.Exchange
 }
 
 // Queue get queue setting
+// 配置了死信时，Args中包含x-dead-letter-exchange/x-dead-letter-routing-key
 func (s *Session) Queue() queue.Queue {
-	return s.broker.Queue
+	q := s.broker.Queue
+	dl, err := s.DeadLetter()
+	if err != nil || !dl.Enabled {
+		return q
+	}
+	args := make(external.XTable, len(q.Args)+2)
+	for k, v := range q.Args {
+		args[k] = v
+	}
+	args["x-dead-letter-exchange"] = dl.Exchange
+	args["x-dead-letter-routing-key"] = dl.Queue
+	q.Args = args
+	return q
+}
+
+// DeadLetter get dead letter setting，未指定的名字根据队列名生成
+func (s *Session) DeadLetter() (broker.DeadLetter, error) {
+	dl := s.broker.DeadLetter
+	if !dl.Enabled {
+		return dl, nil
+	}
+	name := s.broker.Queue.Name
+	if name == "" && (dl.Exchange == "" || dl.Queue == "") {
+		return dl, fmt.Errorf("session dead letter error: the \"queue's Name\" is generated by server, dead letter exchange and queue must be specified")
+	}
+	if dl.Exchange == "" {
+		dl.Exchange = name + ".dlx"
+	}
+	if dl.Queue == "" {
+		dl.Queue = queue.DeadLetterName(name)
+	}
+	return dl, nil
 }
 
 // Binding get binding setting
@@ -86,6 +298,23 @@ func (s *Session) Binding() binding.Binding {
 	return s.broker.Binding
 }
 
+// Bindings get all bindings，包括Binding及WithBindings添加的绑定，交换机为空时为会话的交换机
+// 只有WithBindings添加的绑定时，Binding未设置RoutingKey及Args则忽略
+func (s *Session) Bindings() []binding.Binding {
+	bindings := make([]binding.Binding, 0, len(s.broker.Bindings)+1)
+	primary := s.broker.Binding
+	if len(s.broker.Bindings) == 0 || primary.RoutingKey != "" || len(primary.Args) > 0 {
+		bindings = append(bindings, primary)
+	}
+	bindings = append(bindings, s.broker.Bindings...)
+	for i := range bindings {
+		if bindings[i].Exchange == "" {
+			bindings[i].Exchange = s.broker.Exchange.Name
+		}
+	}
+	return bindings
+}
+
 // OptionsConsumer get consumerOptions
 func (s *Session) OptionsConsumer() consumeropts.Options {
 	return s.consumerOptions
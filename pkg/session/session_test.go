@@ -0,0 +1,113 @@
+package session
+
+import (
+	"reflect"
+	"testing"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session/broker"
+	"xrabbitmq/pkg/session/broker/binding"
+	"xrabbitmq/pkg/session/broker/exchange"
+	"xrabbitmq/pkg/session/broker/queue"
+)
+
+func TestDeadLetter(t *testing.T) {
+	cases := []struct {
+		name     string
+		queue    string
+		exchange string
+		dlQueue  string
+		enabled  bool
+		want     external.XTable
+		error    bool
+	}{
+		{name: "disabled", queue: "jobs"},
+		{name: "names from queue", queue: "jobs", enabled: true, want: external.XTable{
+			"x-max-length":              int64(10),
+			"x-dead-letter-exchange":    "jobs.dlx",
+			"x-dead-letter-routing-key": queue.DeadLetterName("jobs"),
+		}},
+		{name: "names given", queue: "jobs", exchange: "dlx", dlQueue: "parking", enabled: true, want: external.XTable{
+			"x-max-length":              int64(10),
+			"x-dead-letter-exchange":    "dlx",
+			"x-dead-letter-routing-key": "parking",
+		}},
+		{name: "server-named with names given", exchange: "dlx", dlQueue: "parking", enabled: true, want: external.XTable{
+			"x-max-length":              int64(10),
+			"x-dead-letter-exchange":    "dlx",
+			"x-dead-letter-routing-key": "parking",
+		}},
+		{name: "server-named without names", exchange: "dlx", enabled: true, error: true},
+	}
+	for _, c := range cases {
+		opts := []broker.Option{broker.WithQueue(queue.SetName(c.queue), queue.WithArgs(external.XTable{"x-max-length": int64(10)}))}
+		if c.enabled {
+			opts = append(opts, broker.WithDeadLetter(c.exchange, c.dlQueue))
+		}
+		sess := NewSession(WithBrokerOptions(opts...))
+
+		dl, err := sess.DeadLetter()
+		if (err != nil) != c.error {
+			t.Errorf("%s: DeadLetter error = %v, want error = %v", c.name, err, c.error)
+			continue
+		}
+		if dl.Enabled != c.enabled {
+			t.Errorf("%s: Enabled = %v, want %v", c.name, dl.Enabled, c.enabled)
+		}
+		want := c.want
+		if want == nil {
+			// 未配置死信或配置有误时不修改队列的Args
+			want = external.XTable{"x-max-length": int64(10)}
+		}
+		if got := sess.Queue().Args; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: queue args = %v, want %v", c.name, got, want)
+		}
+	}
+}
+
+func TestBindings(t *testing.T) {
+	orders := broker.WithExchange(exchange.SetName("orders"))
+	cases := []struct {
+		name string
+		opts []broker.Option
+		want []binding.Binding
+	}{
+		{
+			name: "primary only",
+			opts: []broker.Option{orders, broker.WithBinding(binding.SetRoutingKey("created"))},
+			want: []binding.Binding{{Exchange: "orders", RoutingKey: "created"}},
+		},
+		{
+			name: "empty primary kept without additional bindings",
+			opts: []broker.Option{orders},
+			want: []binding.Binding{{Exchange: "orders"}},
+		},
+		{
+			name: "empty primary dropped",
+			opts: []broker.Option{orders, broker.WithBindings(binding.New("", "created", nil), binding.New("audit", "#", nil))},
+			want: []binding.Binding{{Exchange: "orders", RoutingKey: "created"}, {Exchange: "audit", RoutingKey: "#"}},
+		},
+		{
+			name: "primary and additional",
+			opts: []broker.Option{orders, broker.WithBinding(binding.SetRoutingKey("created")), broker.WithBindings(binding.New("", "deleted", nil))},
+			want: []binding.Binding{{Exchange: "orders", RoutingKey: "created"}, {Exchange: "orders", RoutingKey: "deleted"}},
+		},
+		{
+			name: "headers primary kept",
+			opts: []broker.Option{orders, broker.WithBinding(binding.WithHeaders(external.XTable{"tenant": "a"})), broker.WithBindings(binding.New("", "", external.XTable{"tenant": "b"}))},
+			want: []binding.Binding{
+				{Exchange: "orders", Args: external.XTable{"tenant": "a"}},
+				{Exchange: "orders", Args: external.XTable{"tenant": "b"}},
+			},
+		},
+	}
+	for _, c := range cases {
+		sess := NewSession(WithBrokerOptions(c.opts...))
+		if got := sess.Bindings(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: Bindings = %+v, want %+v", c.name, got, c.want)
+		}
+		// 得到的是副本，补全交换机名不影响会话的配置
+		if sess.broker.Binding.Exchange != "" {
+			t.Errorf("%s: session binding changed to %+v", c.name, sess.broker.Binding)
+		}
+	}
+}
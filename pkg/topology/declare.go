@@ -0,0 +1,115 @@
+package topology
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"xrabbitmq/pkg/external"
+)
+
+// ErrPreconditionFailed 服务端已存在同名的交换机/队列，但属性与拓扑中的不一致
+var ErrPreconditionFailed = errors.New("topology: precondition failed")
+
+// DeclareError 声明拓扑中的某一项时发生的错误
+type DeclareError struct {
+	// Kind exchange/queue/binding
+	Kind string
+
+	Name string
+
+	Err error
+}
+
+func (e *DeclareError) Error() string {
+	if e.mismatch() {
+		return fmt.Sprintf("topology: %s %q already exists with different properties, "+
+			"delete it or align the definition: %s", e.Kind, e.Name, e.Err)
+	}
+	return fmt.Sprintf("topology: declare %s %q error: %s", e.Kind, e.Name, e.Err)
+}
+
+func (e *DeclareError) Unwrap() error {
+	return e.Err
+}
+
+// Is 属性不一致时errors.Is(err, ErrPreconditionFailed)为true
+func (e *DeclareError) Is(target error) bool {
+	return target == ErrPreconditionFailed && e.mismatch()
+}
+
+func (e *DeclareError) mismatch() bool {
+	var amqpErr *external.XError
+	return errors.As(e.Err, &amqpErr) && amqpErr.Code == external.XPreconditionFailed
+}
+
+// Declare 在conn上新建一个通信管道，依次声明交换机、队列、队列绑定、交换机之间的绑定
+// 重复声明是幂等的；服务端返回错误时通信管道会被关闭，所以在第一个错误处停止并返回*DeclareError
+func Declare(ctx context.Context, conn *external.XConnection, t *Topology) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("topology: open channel error: %w", err)
+	}
+	defer channel.Close()
+
+	// ctx到期时关闭通信管道，使阻塞中的声明返回
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = channel.Close()
+		case <-done:
+		}
+	}()
+
+	if err := declare(ctx, channel, t); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// declare 按依赖顺序声明：绑定的两端需要先存在
+func declare(ctx context.Context, channel *external.XChannel, t *Topology) error {
+	for _, e := range t.Exchanges {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := channel.ExchangeDeclare(e.Name, e.Type, e.Durable, e.AutoDelete, e.Internal, false, e.Args); err != nil {
+			return &DeclareError{Kind: "exchange", Name: e.Name, Err: err}
+		}
+	}
+	for _, q := range t.Queues {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := channel.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, false, q.Args); err != nil {
+			return &DeclareError{Kind: "queue", Name: q.Name, Err: err}
+		}
+	}
+	for _, typ := range []string{DestinationQueue, DestinationExchange} {
+		for _, b := range t.Bindings {
+			if b.destinationType() != typ {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var err error
+			if typ == DestinationQueue {
+				err = channel.QueueBind(b.Destination, b.RoutingKey, b.Source, false, b.Args)
+			} else {
+				err = channel.ExchangeBind(b.Destination, b.RoutingKey, b.Source, false, b.Args)
+			}
+			if err != nil {
+				return &DeclareError{Kind: "binding", Name: b.String(), Err: err}
+			}
+		}
+	}
+	return nil
+}
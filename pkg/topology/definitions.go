@@ -0,0 +1,185 @@
+package topology
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+)
+
+// definitions RabbitMQ管理插件导入/导出的definitions.json，只关心其中的拓扑部分
+type definitions struct {
+	RabbitVersion string               `json:"rabbit_version,omitempty"`
+	Exchanges     []exchangeDefinition `json:"exchanges"`
+	Queues        []queueDefinition    `json:"queues"`
+	Bindings      []bindingDefinition  `json:"bindings"`
+
+	// Policies 策略需要通过rabbitmqctl或管理接口设置，不能通过AMQP声明
+	Policies []json.RawMessage `json:"policies,omitempty"`
+}
+
+// definitions.json中的arguments不能省略，所以不使用omitempty
+
+type exchangeDefinition struct {
+	Name       string          `json:"name"`
+	Vhost      string          `json:"vhost"`
+	Type       string          `json:"type"`
+	Durable    bool            `json:"durable"`
+	AutoDelete bool            `json:"auto_delete"`
+	Internal   bool            `json:"internal"`
+	Arguments  external.XTable `json:"arguments"`
+}
+
+type queueDefinition struct {
+	Name       string          `json:"name"`
+	Vhost      string          `json:"vhost"`
+	Durable    bool            `json:"durable"`
+	AutoDelete bool            `json:"auto_delete"`
+	Arguments  external.XTable `json:"arguments"`
+}
+
+type bindingDefinition struct {
+	Source          string          `json:"source"`
+	Vhost           string          `json:"vhost"`
+	Destination     string          `json:"destination"`
+	DestinationType string          `json:"destination_type"`
+	RoutingKey      string          `json:"routing_key"`
+	Arguments       external.XTable `json:"arguments"`
+}
+
+// builtin 默认交换机及amq.*交换机由服务端创建，不能被声明
+func builtin(exchange string) bool {
+	return exchange == "" || strings.HasPrefix(exchange, "amq.")
+}
+
+// ParseDefinitions 从管理插件的definitions.json中得到虚拟主机vhost上的交换机、队列及绑定
+// 未指定vhost的项也会被包含；用户、权限、策略等不属于拓扑的内容被忽略，其中策略会输出警告
+func ParseDefinitions(data []byte, vhost string) (*Topology, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	defs := &definitions{}
+	if err := decoder.Decode(defs); err != nil {
+		return nil, fmt.Errorf("topology: parse definitions error: %w", err)
+	}
+	if len(defs.Policies) > 0 {
+		log.Logger.Warningf("topology: %d policies in definitions are ignored, apply them with rabbitmqctl or the management API", len(defs.Policies))
+	}
+
+	in := func(v string) bool {
+		return v == "" || v == vhost
+	}
+	t := &Topology{}
+	for _, e := range defs.Exchanges {
+		if !in(e.Vhost) || builtin(e.Name) {
+			continue
+		}
+		t.Exchanges = append(t.Exchanges, Exchange{
+			Name:       e.Name,
+			Type:       e.Type,
+			Durable:    e.Durable,
+			AutoDelete: e.AutoDelete,
+			Internal:   e.Internal,
+			Args:       e.Arguments,
+		})
+	}
+	for _, q := range defs.Queues {
+		if !in(q.Vhost) {
+			continue
+		}
+		t.Queues = append(t.Queues, Queue{
+			Name:       q.Name,
+			Durable:    q.Durable,
+			AutoDelete: q.AutoDelete,
+			Args:       q.Arguments,
+		})
+	}
+	for _, b := range defs.Bindings {
+		if !in(b.Vhost) {
+			continue
+		}
+		t.Bindings = append(t.Bindings, Binding{
+			Source:          b.Source,
+			Destination:     b.Destination,
+			DestinationType: b.DestinationType,
+			RoutingKey:      b.RoutingKey,
+			Args:            b.Arguments,
+		})
+	}
+	t.normalize()
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// LoadDefinitions 从管理插件的definitions.json文件加载拓扑，同ParseDefinitions
+func LoadDefinitions(path, vhost string) (*Topology, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("topology: load definitions error: %w", err)
+	}
+	return ParseDefinitions(data, vhost)
+}
+
+// Definitions 将拓扑导出为虚拟主机vhost上的definitions.json，可通过管理插件导入
+// 排他队列只属于声明它的连接，不会被导出
+func (t *Topology) Definitions(vhost string) ([]byte, error) {
+	defs := definitions{
+		Exchanges: make([]exchangeDefinition, 0, len(t.Exchanges)),
+		Queues:    make([]queueDefinition, 0, len(t.Queues)),
+		Bindings:  make([]bindingDefinition, 0, len(t.Bindings)),
+	}
+	exclusive := make(map[string]bool)
+	for _, e := range t.Exchanges {
+		defs.Exchanges = append(defs.Exchanges, exchangeDefinition{
+			Name:       e.Name,
+			Vhost:      vhost,
+			Type:       e.Type,
+			Durable:    e.Durable,
+			AutoDelete: e.AutoDelete,
+			Internal:   e.Internal,
+			Arguments:  arguments(e.Args),
+		})
+	}
+	for _, q := range t.Queues {
+		if q.Exclusive {
+			exclusive[q.Name] = true
+			continue
+		}
+		defs.Queues = append(defs.Queues, queueDefinition{
+			Name:       q.Name,
+			Vhost:      vhost,
+			Durable:    q.Durable,
+			AutoDelete: q.AutoDelete,
+			Arguments:  arguments(q.Args),
+		})
+	}
+	for _, b := range t.Bindings {
+		if b.destinationType() == DestinationQueue && exclusive[b.Destination] {
+			continue
+		}
+		defs.Bindings = append(defs.Bindings, bindingDefinition{
+			Source:          b.Source,
+			Vhost:           vhost,
+			Destination:     b.Destination,
+			DestinationType: b.destinationType(),
+			RoutingKey:      b.RoutingKey,
+			Arguments:       arguments(b.Args),
+		})
+	}
+	data, err := json.MarshalIndent(defs, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("topology: export definitions error: %w", err)
+	}
+	return data, nil
+}
+
+func arguments(args external.XTable) external.XTable {
+	if args == nil {
+		return external.XTable{}
+	}
+	return args
+}
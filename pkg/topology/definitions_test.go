@@ -0,0 +1,157 @@
+package topology
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// captureLog 将log.Logger替换为记录日志的logger，测试结束后恢复
+func captureLog(t *testing.T) *test.Hook {
+	logger, hook := test.NewNullLogger()
+	old := log.Logger
+	log.SetLogger(logger)
+	t.Cleanup(func() { log.SetLogger(old) })
+	return hook
+}
+
+const exported = `{
+	"rabbit_version": "3.8.9",
+	"users": [{"name": "guest", "tags": "administrator"}],
+	"exchanges": [
+		{"name": "orders", "vhost": "/", "type": "topic", "durable": true, "auto_delete": false, "internal": false, "arguments": {}},
+		{"name": "amq.direct", "vhost": "/", "type": "direct", "durable": true, "auto_delete": false, "internal": false, "arguments": {}},
+		{"name": "billing", "vhost": "billing", "type": "fanout", "durable": true, "auto_delete": false, "internal": false, "arguments": {}}
+	],
+	"queues": [
+		{"name": "orders.created", "vhost": "/", "durable": true, "auto_delete": false, "arguments": {"x-message-ttl": 60000, "x-queue-type": "classic"}},
+		{"name": "invoices", "vhost": "billing", "durable": true, "auto_delete": false, "arguments": {}}
+	],
+	"bindings": [
+		{"source": "orders", "vhost": "/", "destination": "orders.created", "destination_type": "queue", "routing_key": "created.#", "arguments": {}},
+		{"source": "billing", "vhost": "billing", "destination": "invoices", "destination_type": "queue", "routing_key": "", "arguments": {}}
+	],
+	"policies": [
+		{"vhost": "/", "name": "ha", "pattern": ".*", "apply-to": "queues", "definition": {"ha-mode": "all"}, "priority": 0}
+	]
+}`
+
+func TestDefinitionsRoundTrip(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     string
+		vhost    string
+		want     *Topology
+		warnings int
+	}{
+		{
+			name:  "filter vhost and skip amq.*",
+			data:  exported,
+			vhost: "/",
+			want: &Topology{
+				Exchanges: []Exchange{{Name: "orders", Type: "topic", Durable: true, Args: external.XTable{}}},
+				Queues: []Queue{{Name: "orders.created", Durable: true, Args: external.XTable{
+					"x-message-ttl": int64(60000),
+					"x-queue-type":  "classic",
+				}}},
+				Bindings: []Binding{{Source: "orders", Destination: "orders.created", DestinationType: DestinationQueue, RoutingKey: "created.#", Args: external.XTable{}}},
+			},
+			warnings: 1,
+		},
+		{
+			name:  "other vhost",
+			data:  exported,
+			vhost: "billing",
+			want: &Topology{
+				Exchanges: []Exchange{{Name: "billing", Type: "fanout", Durable: true, Args: external.XTable{}}},
+				Queues:    []Queue{{Name: "invoices", Durable: true, Args: external.XTable{}}},
+				Bindings:  []Binding{{Source: "billing", Destination: "invoices", DestinationType: DestinationQueue, Args: external.XTable{}}},
+			},
+			warnings: 1,
+		},
+		{
+			name: "items without vhost and no policies",
+			data: `{
+				"exchanges": [{"name": "events", "type": "fanout", "durable": false, "arguments": {}}],
+				"queues": [],
+				"bindings": [{"source": "events", "destination": "audit", "destination_type": "exchange", "routing_key": "", "arguments": {}}]
+			}`,
+			vhost: "/",
+			want: &Topology{
+				Exchanges: []Exchange{{Name: "events", Type: "fanout", Args: external.XTable{}}},
+				Bindings:  []Binding{{Source: "events", Destination: "audit", DestinationType: DestinationExchange, Args: external.XTable{}}},
+			},
+		},
+	}
+	for _, c := range cases {
+		hook := captureLog(t)
+
+		got, err := ParseDefinitions([]byte(c.data), c.vhost)
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: parsed %#v, want %#v", c.name, got, c.want)
+		}
+		warnings := 0
+		for _, entry := range hook.AllEntries() {
+			if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "policies") {
+				warnings++
+			}
+		}
+		if warnings != c.warnings {
+			t.Errorf("%s: %d policy warnings, want %d", c.name, warnings, c.warnings)
+		}
+
+		// 导出后再导入得到相同的拓扑
+		data, err := got.Definitions(c.vhost)
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		again, err := ParseDefinitions(data, c.vhost)
+		if err != nil {
+			t.Fatalf("%s: parse exported definitions: %s", c.name, err)
+		}
+		if !reflect.DeepEqual(again, c.want) {
+			t.Errorf("%s: round trip %#v, want %#v", c.name, again, c.want)
+		}
+	}
+}
+
+func TestDefinitionsDropExclusive(t *testing.T) {
+	topo := &Topology{
+		Exchanges: []Exchange{{Name: "events", Type: "fanout"}},
+		Queues: []Queue{
+			{Name: "audit", Durable: true},
+			{Name: "session-local", Exclusive: true},
+		},
+		Bindings: []Binding{
+			{Source: "events", Destination: "audit"},
+			{Source: "events", Destination: "session-local"},
+		},
+	}
+	data, err := topo.Definitions("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseDefinitions(data, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Topology{
+		Exchanges: []Exchange{{Name: "events", Type: "fanout", Args: external.XTable{}}},
+		Queues:    []Queue{{Name: "audit", Durable: true, Args: external.XTable{}}},
+		Bindings:  []Binding{{Source: "events", Destination: "audit", DestinationType: DestinationQueue, Args: external.XTable{}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("exported %#v, want %#v", got, want)
+	}
+	if strings.Contains(string(data), "session-local") {
+		t.Errorf("exclusive queue exported: %s", data)
+	}
+}
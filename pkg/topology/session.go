@@ -0,0 +1,147 @@
+package topology
+
+import (
+	"reflect"
+	"time"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+	"xrabbitmq/pkg/session/broker/queue"
+)
+
+// FromSessions 根据会话的交换机/队列/绑定配置得到拓扑，包括死信及延迟重试需要的交换机和队列
+// 同名的交换机/队列只保留第一个；服务端生成名字的队列、排他队列及它们的绑定被忽略
+func FromSessions(sessions ...*session.Session) *Topology {
+	t := &Topology{}
+	for _, sess := range sessions {
+		t.Merge(fromSession(sess))
+	}
+	return t
+}
+
+func fromSession(sess *session.Session) *Topology {
+	t := &Topology{}
+	e := sess.Exchange()
+	if !builtin(e.Name) {
+		t.Exchanges = append(t.Exchanges, Exchange{
+			Name:       e.Name,
+			Type:       e.Typ,
+			Durable:    e.Durable,
+			AutoDelete: e.AutoDelete,
+			Internal:   e.Internal,
+			Args:       e.Args,
+		})
+	}
+
+	q := sess.Queue()
+	if q.Name == "" {
+		return t
+	}
+	if !q.Exclusive {
+		t.Queues = append(t.Queues, Queue{
+			Name:       q.Name,
+			Durable:    q.Durable,
+			AutoDelete: q.AutoDelete,
+			Args:       q.Args,
+		})
+	}
+	for _, b := range sess.Bindings() {
+		if q.Exclusive || builtin(b.Exchange) {
+			continue
+		}
+		t.Bindings = append(t.Bindings, Binding{
+			Source:          b.Exchange,
+			Destination:     q.Name,
+			DestinationType: DestinationQueue,
+			RoutingKey:      b.RoutingKey,
+			Args:            b.Args,
+		})
+	}
+
+	dl, err := sess.DeadLetter()
+	if err == nil && dl.Enabled {
+		t.Exchanges = append(t.Exchanges, Exchange{Name: dl.Exchange, Type: external.XExchangeDirect, Durable: true})
+		t.Queues = append(t.Queues, Queue{Name: dl.Queue, Durable: true})
+		t.Bindings = append(t.Bindings, Binding{
+			Source:          dl.Exchange,
+			Destination:     dl.Queue,
+			DestinationType: DestinationQueue,
+			RoutingKey:      dl.Queue,
+		})
+	}
+
+	// 与消费者声明的延迟队列及停放重试次数用尽的消息的死信队列一致
+	delays := sess.OptionsConsumer().RetryDelays
+	for _, delay := range delays {
+		t.Queues = append(t.Queues, Queue{
+			Name:    queue.RetryName(q.Name, delay),
+			Durable: q.Durable,
+			Args: external.XTable{
+				"x-message-ttl":             int64(delay / time.Millisecond),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": q.Name,
+			},
+		})
+	}
+	if len(delays) > 0 && !dl.Enabled {
+		t.Queues = append(t.Queues, Queue{Name: queue.DeadLetterName(q.Name), Durable: q.Durable})
+	}
+	return t
+}
+
+// Merge 合并other中的交换机/队列/绑定，已存在的同名交换机/队列及相同(包括Args)的绑定被忽略
+func (t *Topology) Merge(other *Topology) {
+	for _, e := range other.Exchanges {
+		if !t.hasExchange(e.Name) {
+			t.Exchanges = append(t.Exchanges, e)
+		}
+	}
+	for _, q := range other.Queues {
+		if !t.hasQueue(q.Name) {
+			t.Queues = append(t.Queues, q)
+		}
+	}
+	for _, b := range other.Bindings {
+		if !t.hasBinding(b) {
+			t.Bindings = append(t.Bindings, b)
+		}
+	}
+}
+
+func (t *Topology) hasExchange(name string) bool {
+	for _, e := range t.Exchanges {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Topology) hasQueue(name string) bool {
+	for _, q := range t.Queues {
+		if q.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBinding 绑定的两端、RoutingKey及Args都相同时视为相同的绑定
+// headers交换机的绑定RoutingKey一般为空，只能通过Args区分
+func (t *Topology) hasBinding(b Binding) bool {
+	for _, existing := range t.Bindings {
+		if existing.Source == b.Source && existing.Destination == b.Destination &&
+			existing.destinationType() == b.destinationType() && existing.RoutingKey == b.RoutingKey &&
+			sameArgs(existing.Args, b.Args) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameArgs Args是否相同，nil与空表视为相同
+func sameArgs(a, b external.XTable) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,111 @@
+package topology
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+	"xrabbitmq/pkg/session/broker"
+	"xrabbitmq/pkg/session/broker/binding"
+	"xrabbitmq/pkg/session/broker/exchange"
+	"xrabbitmq/pkg/session/broker/queue"
+	"xrabbitmq/pkg/session/consumeropts"
+)
+
+func headersSession(queueName string, exclusive bool, bindings ...binding.Binding) *session.Session {
+	return session.NewSession(session.WithBrokerOptions(
+		broker.WithExchange(exchange.SetName("tenants"), exchange.SetType(external.XExchangeHeaders), exchange.SetDurable(true)),
+		broker.WithQueue(queue.SetName(queueName), queue.SetDurable(true), queue.SetExclusive(exclusive)),
+		broker.WithBindings(bindings...),
+	))
+}
+
+func tenant(name string) external.XTable {
+	return external.XTable{"x-match": "all", "tenant": name}
+}
+
+func TestFromSessions(t *testing.T) {
+	tenants := Exchange{Name: "tenants", Type: external.XExchangeHeaders, Durable: true}
+	cases := []struct {
+		name     string
+		sessions []*session.Session
+		want     *Topology
+	}{
+		{
+			name: "headers bindings differing only by args",
+			sessions: []*session.Session{
+				headersSession("billing", false, binding.New("", "", tenant("a"))),
+				headersSession("billing", false, binding.New("", "", tenant("b")), binding.New("", "", tenant("a"))),
+			},
+			want: &Topology{
+				Exchanges: []Exchange{tenants},
+				Queues:    []Queue{{Name: "billing", Durable: true}},
+				Bindings: []Binding{
+					{Source: "tenants", Destination: "billing", DestinationType: DestinationQueue, Args: tenant("a")},
+					{Source: "tenants", Destination: "billing", DestinationType: DestinationQueue, Args: tenant("b")},
+				},
+			},
+		},
+		{
+			name: "exclusive and server-named queues",
+			sessions: []*session.Session{
+				headersSession("local", true, binding.New("", "", tenant("a"))),
+				headersSession("", false, binding.New("", "", tenant("a"))),
+			},
+			want: &Topology{Exchanges: []Exchange{tenants}},
+		},
+		{
+			name: "retry queues",
+			sessions: []*session.Session{session.NewSession(
+				session.WithBrokerOptions(broker.WithQueue(queue.SetName("jobs"), queue.SetDurable(true))),
+				session.WithConsumerOptions(consumeropts.WithRetry(0, time.Second)),
+			)},
+			want: &Topology{
+				Queues: []Queue{
+					{Name: "jobs", Durable: true},
+					{Name: queue.RetryName("jobs", time.Second), Durable: true, Args: external.XTable{
+						"x-message-ttl":             int64(1000),
+						"x-dead-letter-exchange":    "",
+						"x-dead-letter-routing-key": "jobs",
+					}},
+					{Name: queue.DeadLetterName("jobs"), Durable: true},
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		got := FromSessions(c.sessions...)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: FromSessions = %#v, want %#v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestMergeBindings(t *testing.T) {
+	base := Binding{Source: "e", Destination: "q", RoutingKey: "k"}
+	withArgs := func(args external.XTable) Binding {
+		b := base
+		b.Args = args
+		return b
+	}
+	cases := []struct {
+		name  string
+		other Binding
+		added bool
+	}{
+		{"same", base, false},
+		{"empty args same as nil", withArgs(external.XTable{}), false},
+		{"explicit queue destination", Binding{Source: "e", Destination: "q", DestinationType: DestinationQueue, RoutingKey: "k"}, false},
+		{"different key", Binding{Source: "e", Destination: "q", RoutingKey: "other"}, true},
+		{"different args", withArgs(tenant("a")), true},
+		{"exchange destination", Binding{Source: "e", Destination: "q", DestinationType: DestinationExchange, RoutingKey: "k"}, true},
+	}
+	for _, c := range cases {
+		topo := &Topology{Bindings: []Binding{base}}
+		topo.Merge(&Topology{Bindings: []Binding{c.other}})
+		if added := len(topo.Bindings) == 2; added != c.added {
+			t.Errorf("%s: merged %d bindings, want added = %v", c.name, len(topo.Bindings), c.added)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// 声明式的拓扑：交换机、队列、队列绑定及交换机之间的绑定
+// 拓扑可以用Go结构体描述，也可以从JSON加载(字段名与RabbitMQ管理插件导出的definitions.json一致)
+package topology
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"xrabbitmq/pkg/external"
+)
+
+const (
+	// DestinationQueue 绑定的目标为队列
+	DestinationQueue = "queue"
+
+	// DestinationExchange 绑定的目标为交换机
+	DestinationExchange = "exchange"
+)
+
+// Topology 拓扑
+type Topology struct {
+	Exchanges []Exchange `json:"exchanges"`
+	Queues    []Queue    `json:"queues"`
+	Bindings  []Binding  `json:"bindings"`
+}
+
+// Exchange 交换机
+type Exchange struct {
+	Name string `json:"name"`
+
+	// Type direct/fanout/topic/headers或插件提供的类型
+	Type string `json:"type"`
+
+	Durable    bool            `json:"durable"`
+	AutoDelete bool            `json:"auto_delete"`
+	Internal   bool            `json:"internal"`
+	Args       external.XTable `json:"arguments,omitempty"`
+}
+
+// Queue 队列，名字不能由服务端生成
+// 排他队列只属于声明它的连接，断线重连后不会被重新声明，所以不能出现在拓扑中，应由消费者自行声明
+type Queue struct {
+	Name       string          `json:"name"`
+	Durable    bool            `json:"durable"`
+	AutoDelete bool            `json:"auto_delete"`
+	Exclusive  bool            `json:"exclusive,omitempty"`
+	Args       external.XTable `json:"arguments,omitempty"`
+}
+
+// Binding 绑定，将交换机Source上的消息路由到队列或交换机Destination
+type Binding struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+
+	// DestinationType queue/exchange，为空时为queue
+	DestinationType string `json:"destination_type"`
+
+	RoutingKey string          `json:"routing_key"`
+	Args       external.XTable `json:"arguments,omitempty"`
+}
+
+func (b Binding) String() string {
+	return fmt.Sprintf("%s -> %s %s(%s)", b.Source, b.destinationType(), b.Destination, b.RoutingKey)
+}
+
+func (b Binding) destinationType() string {
+	if b.DestinationType == "" {
+		return DestinationQueue
+	}
+	return b.DestinationType
+}
+
+// Parse 从JSON解析拓扑并校验
+func Parse(data []byte) (*Topology, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// 数字保留为json.Number，以便x-message-ttl等参数以整数发送给服务端
+	decoder.UseNumber()
+	t := &Topology{}
+	if err := decoder.Decode(t); err != nil {
+		return nil, fmt.Errorf("topology: parse error: %w", err)
+	}
+	t.normalize()
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Load 从JSON文件加载拓扑
+func Load(path string) (*Topology, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("topology: load error: %w", err)
+	}
+	return Parse(data)
+}
+
+// Validate 校验拓扑中的名字、排他队列及绑定的目标类型
+func (t *Topology) Validate() error {
+	for _, e := range t.Exchanges {
+		if e.Name == "" {
+			return fmt.Errorf("topology: exchange's Name must be specified")
+		}
+		if e.Type == "" {
+			return fmt.Errorf("topology: exchange %q's Type must be specified", e.Name)
+		}
+	}
+	for _, q := range t.Queues {
+		if q.Name == "" {
+			return fmt.Errorf("topology: queue's Name must be specified")
+		}
+		if q.Exclusive {
+			return fmt.Errorf("topology: queue %q: exclusive queues are not re-declared after reconnect, declare them from the consumer", q.Name)
+		}
+	}
+	for _, b := range t.Bindings {
+		// 默认交换机不允许绑定
+		if b.Source == "" || b.Destination == "" {
+			return fmt.Errorf("topology: binding %s: Source and Destination must be specified", b)
+		}
+		if typ := b.destinationType(); typ != DestinationQueue && typ != DestinationExchange {
+			return fmt.Errorf("topology: binding %s: unknown DestinationType %q", b, typ)
+		}
+	}
+	return nil
+}
+
+// normalize 将JSON解码得到的参数转换为AMQP支持的类型
+func (t *Topology) normalize() {
+	for i := range t.Exchanges {
+		t.Exchanges[i].Args = normalizeTable(t.Exchanges[i].Args)
+	}
+	for i := range t.Queues {
+		t.Queues[i].Args = normalizeTable(t.Queues[i].Args)
+	}
+	for i := range t.Bindings {
+		t.Bindings[i].Args = normalizeTable(t.Bindings[i].Args)
+	}
+}
+
+func normalizeTable(table map[string]interface{}) external.XTable {
+	if table == nil {
+		return nil
+	}
+	normalized := make(external.XTable, len(table))
+	for k, v := range table {
+		normalized[k] = normalizeValue(v)
+	}
+	return normalized
+}
+
+// normalizeValue 整数转换为int64，其余数字转换为float64，嵌套的对象转换为XTable
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		return normalizeTable(v)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i := range v {
+			values[i] = normalizeValue(v[i])
+		}
+		return values
+	}
+	return v
+}
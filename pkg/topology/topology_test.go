@@ -0,0 +1,127 @@
+package topology
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"xrabbitmq/pkg/external"
+)
+
+func TestParseNormalizesArgs(t *testing.T) {
+	topo, err := Parse([]byte(`{
+		"exchanges": [{"name": "orders", "type": "topic", "durable": true}],
+		"queues": [{
+			"name": "orders.created",
+			"durable": true,
+			"arguments": {
+				"x-message-ttl": 60000,
+				"x-max-priority": 10,
+				"ratio": 0.5,
+				"big": 1e3,
+				"x-queue-type": "quorum",
+				"nested": {"n": 1, "list": [2, 2.5, "s"]}
+			}
+		}],
+		"bindings": [{"source": "orders", "destination": "orders.created", "routing_key": "created.#"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := topo.Queues[0].Args
+	want := external.XTable{
+		"x-message-ttl":  int64(60000),
+		"x-max-priority": int64(10),
+		"ratio":          0.5,
+		"big":            float64(1000),
+		"x-queue-type":   "quorum",
+		"nested": external.XTable{
+			"n":    int64(1),
+			"list": []interface{}{int64(2), 2.5, "s"},
+		},
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("queue args = %#v, want %#v", args, want)
+	}
+	if topo.Exchanges[0].Args != nil {
+		t.Errorf("exchange args = %#v, want nil", topo.Exchanges[0].Args)
+	}
+	if got := topo.Bindings[0].destinationType(); got != DestinationQueue {
+		t.Errorf("binding destination type = %q, want %q", got, DestinationQueue)
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	cases := []struct {
+		in   interface{}
+		want interface{}
+	}{
+		{json.Number("42"), int64(42)},
+		{json.Number("-7"), int64(-7)},
+		{json.Number("1.5"), 1.5},
+		{json.Number("9223372036854775808"), float64(9223372036854775808)},
+		{"s", "s"},
+		{true, true},
+		{nil, nil},
+	}
+	for _, c := range cases {
+		got := normalizeValue(c.in)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("normalizeValue(%#v) = %#v (%T), want %#v (%T)", c.in, got, got, c.want, c.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		topo Topology
+		err  string
+	}{
+		{"empty", Topology{}, ""},
+		{"exchange without name", Topology{Exchanges: []Exchange{{Type: "direct"}}}, "Name"},
+		{"exchange without type", Topology{Exchanges: []Exchange{{Name: "e"}}}, "Type"},
+		{"queue without name", Topology{Queues: []Queue{{}}}, "Name"},
+		{"exclusive queue", Topology{Queues: []Queue{{Name: "q", Exclusive: true}}}, "exclusive"},
+		{"binding from default exchange", Topology{Bindings: []Binding{{Destination: "q"}}}, "Source"},
+		{"unknown destination type", Topology{Bindings: []Binding{{Source: "e", Destination: "q", DestinationType: "topic"}}}, "DestinationType"},
+		{"exchange binding", Topology{Bindings: []Binding{{Source: "e", Destination: "f", DestinationType: DestinationExchange}}}, ""},
+	}
+	for _, c := range cases {
+		err := c.topo.Validate()
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%s: error = %v, want containing %q", c.name, err, c.err)
+		}
+	}
+}
+
+func TestDeclareErrorIs(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		mismatch bool
+	}{
+		{"precondition failed", &external.XError{Code: external.XPreconditionFailed, Reason: "PRECONDITION_FAILED"}, true},
+		{"wrapped precondition failed", fmt.Errorf("declare: %w", &external.XError{Code: external.XPreconditionFailed}), true},
+		{"not found", &external.XError{Code: external.XNotFound, Reason: "NOT_FOUND"}, false},
+		{"other error", errors.New("boom"), false},
+	}
+	for _, c := range cases {
+		err := error(&DeclareError{Kind: "queue", Name: "q", Err: c.err})
+		if got := errors.Is(err, ErrPreconditionFailed); got != c.mismatch {
+			t.Errorf("%s: errors.Is(ErrPreconditionFailed) = %v, want %v", c.name, got, c.mismatch)
+		}
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: DeclareError does not unwrap to its cause", c.name)
+		}
+		if got := strings.Contains(err.Error(), "already exists"); got != c.mismatch {
+			t.Errorf("%s: Error() = %q", c.name, err.Error())
+		}
+	}
+}
@@ -1,21 +1,26 @@
 package xrabbitmq
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"sync"
+	"time"
 	"xrabbitmq/build"
 	"xrabbitmq/pkg/external"
 	"xrabbitmq/pkg/log"
+	"xrabbitmq/pkg/pool"
+	"xrabbitmq/pkg/rpc"
 	"xrabbitmq/pkg/session"
+	"xrabbitmq/pkg/topology"
 )
 
 // RabbitMQ客户端
 type RabbitMQ struct {
-	// rabbitMQ 客户端连接
-	conn *external.XConnection
-
-	// rabbitMq 通信管道
-	channel *external.XChannel
+	// conns 客户端管理的连接，按照用途分组
+	conns connections
 
 	// 建立连接需要的配置项
 	ConfOptions
@@ -29,102 +34,382 @@ type RabbitMQ struct {
 	// 关闭通知
 	closing chan struct{}
 
+	// events 连接生命周期事件的监听者及回调
+	events events
+
 	wg sync.WaitGroup
 }
 
 // New 根据配置项初始化并返回一个RabbitMQ客户端实例
 func New(opts ...ConfOption) *RabbitMQ {
+	confOptions := defaultConfOptions(opts...)
 	return &RabbitMQ{
 		closing:     make(chan struct{}),
-		ConfOptions: defaultConfOptions(opts...),
+		ConfOptions: confOptions,
+		conns:       newConnections(confOptions),
 	}
 }
 
 // Conn 得到RabbitMQ客户端与目标RabbitMQ服务端之间所建立的连接
+// 断线重连后得到的是新建立的连接；配置了专用连接时得到的是第一个生产者连接
 func (rmq *RabbitMQ) Conn() *external.XConnection {
-	return rmq.conn
+	return rmq.conns.all[0].Conn()
 }
 
 // Startup 启动RabbitMQ客户端
 // 也就是RabbitMQ客户端与目标RabbitMQ服务端在此时会建立连接(仅一次)
 func (rmq *RabbitMQ) Startup() error {
+	return rmq.StartupContext(context.Background())
+}
+
+// StartupContext 同Startup，ctx用于控制建立连接的超时及取消
+func (rmq *RabbitMQ) StartupContext(ctx context.Context) error {
 	var err error
 	rmq.startupOnce.Do(func() {
-		if rmq.conn != nil {
+		if rmq.Conn() != nil {
 			return
 		}
-		err = rmq.dial()
+		for i, c := range rmq.conns.all {
+			if err = rmq.dial(ctx, c); err != nil {
+				c.fail(err)
+				for _, dialed := range rmq.conns.all[:i] {
+					_ = dialed.Conn().Close()
+					dialed.set(nil, nil)
+				}
+				return
+			}
+		}
+		for _, c := range rmq.conns.all {
+			if rmq.ChannelPoolSize > 0 && c.role != roleConsumer {
+				c.pool = pool.New(rmq.ChannelPoolSize, c.Conn)
+			}
+			rmq.wg.Add(1)
+			go rmq.handleErrors(c)
+		}
 	})
 	return err
 }
 
 // Shutdown 关闭RabbitMQ客户端连接
 // 一般用于程序退出前释放当前客户端与服务端之间建立的连接
+// 会一直等待所有消费者处理完手头的消息、所有生产者收到已发送消息的确认
 func (rmq *RabbitMQ) Shutdown() error {
+	return rmq.ShutdownContext(context.Background())
+}
+
+// ShutdownContext 关闭RabbitMQ客户端连接
+// 先停止所有消费者接收新的消息并等待正在处理的消息处理完毕，再等待所有生产者收到已发送消息的确认，
+// 最后关闭连接。ctx到期时不再等待，直接关闭连接，并在返回的错误中说明被放弃的消息；
+// 关闭时不再重连，已断开或排空期间断开的连接上未被确认的消息以producer.ErrClosed结束
+func (rmq *RabbitMQ) ShutdownContext(ctx context.Context) error {
 	log.Logger.Warning("RabbitMQ will shutdown...")
 	var err error
 	rmq.shutdownOnce.Do(func() {
 		close(rmq.closing)
 		rmq.wg.Wait()
-		if err = rmq.conn.Close(); err != nil {
-			if xerr, ok := err.(*external.XError); ok {
-				if xerr.Code != external.ChannelError {
-					err = fmt.Errorf("AMQP connection close error: %w", err)
-					log.Logger.Error("RabbitMQ shutdown error: %s", err)
-					return
+		defer rmq.events.close()
+
+		var clients []build.Client
+		for _, c := range rmq.conns.all {
+			clients = append(clients, c.clients.snapshot()...)
+		}
+		// 重连已经停止，排空期间断开的连接不会再恢复
+		stop := make(chan struct{})
+		lost := make(chan error, len(rmq.conns.all))
+		for _, c := range rmq.conns.all {
+			go func(c *connection) {
+				lost <- c.abandonOnClose(stop)
+			}(c)
+		}
+		abandoned := drain(ctx, clients)
+		close(stop)
+		for range rmq.conns.all {
+			if e := <-lost; e != nil {
+				abandoned = append(abandoned, e)
+			}
+		}
+		for _, c := range rmq.conns.all {
+			c.clients.close()
+			if c.pool != nil {
+				c.pool.Close()
+			}
+		}
+
+		var errs []error
+		for _, c := range rmq.conns.all {
+			if conn := c.Conn(); conn != nil {
+				if e := conn.Close(); e != nil {
+					// 连接已经关闭时amqp返回ChannelError，无需报告
+					if xerr, ok := e.(*external.XError); !ok || xerr.Code != external.ChannelError {
+						errs = append(errs, fmt.Errorf("AMQP connection %s close error: %w", c, e))
+					}
 				}
 			}
+			c.setState(StateClosed)
+		}
+		rmq.events.closed(nil)
+
+		errs = append(errs, abandoned...)
+		if len(errs) > 0 {
+			err = &ShutdownError{Errors: errs}
+			log.Logger.Errorf("%s", err)
+			return
 		}
 		log.Logger.Info("RabbitMQ shutdown OK")
 	})
 	return err
 }
 
+// ShutdownError 关闭时关闭连接失败，或ctx到期时放弃了消息
+type ShutdownError struct {
+	Errors []error
+}
+
+func (e *ShutdownError) Error() string {
+	reasons := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		reasons = append(reasons, err.Error())
+	}
+	return "RabbitMQ shutdown: " + strings.Join(reasons, "; ")
+}
+
+// Is 任意一个错误满足errors.Is时为true
+func (e *ShutdownError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // BuildConsumer 得到消费者构建工具
+// 配置了专用连接时，在消费者连接中轮流选取
 func (rmq *RabbitMQ) BuildConsumer(opts ...session.Option) external.ConsumerBuilder {
+	c := rmq.conns.consumer()
 	return build.NewConsumerBuild(
-		build.DependConn(rmq.conn),
+		build.Depends(
+			build.DependConn(c.Conn()),
+			build.DependRegistry(&c.clients),
+		),
 		opts...,
 	)
 }
 
 // BuildProducer 得到生产者构建工具
+// 配置了专用连接时，在生产者连接中轮流选取
 func (rmq *RabbitMQ) BuildProducer(opts ...session.Option) external.ProducerBuilder {
+	c := rmq.conns.publisher()
 	return build.NewProducerBuild(
-		build.DependConn(rmq.conn),
+		build.Depends(
+			build.DependConn(c.Conn()),
+			build.DependRegistry(&c.clients),
+			build.DependPool(c.pool),
+		),
 		opts...,
 	)
 }
 
+// BuildRPCClient 构建RPC客户端，请求根据会话的交换机及队列名/RoutingKey路由到RPC服务端
+// RPC客户端独占一个通信管道，配置了专用连接时在生产者连接中轮流选取
+func (rmq *RabbitMQ) BuildRPCClient(opts ...session.Option) (*rpc.Client, error) {
+	c := rmq.conns.publisher()
+	sess := session.NewSession(opts...)
+	if err := sess.Establish(c.Conn()); err != nil {
+		return nil, fmt.Errorf("BuildRPCClient error: %w", err)
+	}
+	client, err := rpc.NewClient(sess)
+	if err != nil {
+		_ = sess.Release("")
+		return nil, fmt.Errorf("BuildRPCClient error: %w", err)
+	}
+	c.clients.Register(client)
+	return client, nil
+}
+
+// DeclareTopology 在独立的通信管道上按依赖顺序声明拓扑，重复声明是幂等的
+// 属性与服务端已存在的不一致时，errors.Is(err, topology.ErrPreconditionFailed)为true
+func (rmq *RabbitMQ) DeclareTopology(ctx context.Context, t *topology.Topology) error {
+	conn := rmq.Conn()
+	if conn == nil {
+		return fmt.Errorf("DeclareTopology error: not connected, call Startup first")
+	}
+	if err := topology.Declare(ctx, conn, t); err != nil {
+		return fmt.Errorf("DeclareTopology error: %w", err)
+	}
+	return nil
+}
+
 // dial 顾名思义
-func (rmq *RabbitMQ) dial() error {
-	conf := external.XURI{
+// 依次尝试各个节点建立新的连接，并替换掉c当前持有的连接
+func (rmq *RabbitMQ) dial(ctx context.Context, c *connection) error {
+	if rmq.err != nil {
+		return rmq.err
+	}
+	endpoints, err := rmq.endpoints()
+	if err != nil {
+		return err
+	}
+
+	var conn *external.XConnection
+	for _, ep := range endpoints {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if conn, err = rmq.dialEndpoint(ctx, c, ep); err == nil {
+			log.Logger.Infof("RabbitMQ %s connected to %s", c, ep)
+			break
+		}
+		log.Logger.Warningf("RabbitMQ %s dial %s error: %s", c, ep, err)
+	}
+	if err != nil {
+		return err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	c.set(conn, channel)
+	return nil
+}
+
+// dialEndpoint 与集群中的某个节点建立连接
+func (rmq *RabbitMQ) dialEndpoint(ctx context.Context, c *connection, ep endpoint) (*external.XConnection, error) {
+	uri := external.XURI{
 		Scheme:   "amqp",
-		Host:     rmq.Host,
-		Port:     rmq.Port,
+		Host:     ep.host,
+		Port:     ep.port,
 		Username: rmq.User,
 		Password: rmq.Pwd,
 		Vhost:    rmq.VHost,
-	}.String()
+	}
+	guard := newDialGuard()
+	config := rmq.dialConfig(ctx, c, guard)
 
-	var err error
-	rmq.conn, err = external.XDial(conf)
-	if err != nil {
-		return err
+	if rmq.useTLS() {
+		uri.Scheme = "amqps"
+		// amqp会把ServerName设置为所连接的节点，每次连接使用各自的副本
+		config.TLSClientConfig = rmq.tls.Clone()
+		if rmq.SASLExternal {
+			config.SASL = []external.XAuthentication{&external.XExternalAuth{}}
+		}
 	}
-	rmq.channel, err = rmq.conn.Channel()
+
+	conn, err := external.XDialConfig(uri.String(), config)
+	guard.finish()
 	if err != nil {
-		return err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		// 握手期间ctx被取消，连接的读写已被中断
+		_ = conn.Close()
+		return nil, ctx.Err()
 	}
+	return conn, nil
+}
 
-	rmq.wg.Add(1)
-	go rmq.handleErrors(rmq.conn)
+// dialConfig 根据配置项得到建立连接时的协商参数及客户端属性
+func (rmq *RabbitMQ) dialConfig(ctx context.Context, c *connection, guard *dialGuard) external.XConfig {
+	// 每次建立连接都使用新的属性表，amqp在握手时会修改它
+	props := external.XTable{
+		"product": "xrabbitmq",
+	}
+	for k, v := range rmq.ClientProperties {
+		props[k] = v
+	}
+	if name := c.name(rmq.ConnectionName, len(rmq.conns.all) == 1); name != "" {
+		props["connection_name"] = name
+	}
 
-	return nil
+	return external.XConfig{
+		Vhost:      rmq.VHost,
+		ChannelMax: rmq.ChannelMax,
+		FrameSize:  rmq.FrameSize,
+		Heartbeat:  rmq.Heartbeat,
+		Properties: props,
+		Locale:     rmq.Locale,
+		Dial:       rmq.dialer(ctx, guard),
+	}
 }
 
-// handleErrors 开启一个goroutine来处理/监听连接过程中所发生的错误
-func (rmq *RabbitMQ) handleErrors(conn *external.XConnection) {
+// dialer 建立TCP连接，并为TLS/AMQP握手设置超时，ctx被取消时放弃建立连接
+// DialTimeout小于等于0且ctx没有期限时不设置超时；握手完成后amqp会清除该超时
+// guard不为nil时，握手期间ctx被取消会使握手立即失败
+func (rmq *RabbitMQ) dialer(ctx context.Context, guard *dialGuard) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		if rmq.DialTimeout > 0 {
+			d.Timeout = rmq.DialTimeout
+		}
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		var deadline time.Time
+		if rmq.DialTimeout > 0 {
+			deadline = time.Now().Add(rmq.DialTimeout)
+		}
+		if dl, ok := ctx.Deadline(); ok && (deadline.IsZero() || dl.Before(deadline)) {
+			deadline = dl
+		}
+		if !deadline.IsZero() {
+			if err := conn.SetDeadline(deadline); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+		}
+		if guard != nil {
+			guard.watch(ctx, conn)
+		}
+		return conn, nil
+	}
+}
+
+// dialGuard 在TLS/AMQP握手期间监听ctx，ctx被取消时使阻塞中的握手立即超时
+// 握手结束后不再干预连接
+type dialGuard struct {
+	mu   sync.Mutex
+	done bool
+	stop chan struct{}
+}
+
+func newDialGuard() *dialGuard {
+	return &dialGuard{stop: make(chan struct{})}
+}
+
+// watch ctx被取消且握手还未结束时，中断conn上的读写
+func (g *dialGuard) watch(ctx context.Context, conn net.Conn) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			g.mu.Lock()
+			if !g.done {
+				_ = conn.SetDeadline(time.Now())
+			}
+			g.mu.Unlock()
+		case <-g.stop:
+		}
+	}()
+}
+
+// finish 握手结束
+func (g *dialGuard) finish() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.done {
+		g.done = true
+		close(g.stop)
+	}
+}
+
+// handleErrors 开启一个goroutine来处理/监听连接c上所发生的错误
+// 当连接异常断开时，如果开启了自动重连，会按照退避策略重新建立连接
+func (rmq *RabbitMQ) handleErrors(c *connection) {
 	defer func() {
 		if x := recover(); x != nil {
 			log.Logger.Errorf("Panic:%+v", x)
@@ -132,12 +417,49 @@ func (rmq *RabbitMQ) handleErrors(conn *external.XConnection) {
 		rmq.wg.Done()
 	}()
 
-	closeChan := conn.NotifyClose(make(chan *external.XError))
-	blockChan := conn.NotifyBlocked(make(chan external.XBlocking))
+	for {
+		xerr := rmq.watch(c)
+		if xerr == nil {
+			return
+		}
+		c.fail(xerr)
+		rmq.events.closed(xerr)
+
+		if !rmq.AutoReconnect {
+			log.Logger.Warningf("RabbitMQ %s connection lost, auto reconnect disabled.", c)
+			c.setState(StateClosed)
+			return
+		}
+		c.setState(StateReconnecting)
+		if !rmq.reconnect(c) {
+			c.setState(StateClosed)
+			return
+		}
+		c.reconnected()
+		c.clients.recover(c.Conn())
+		rmq.events.reconnected(c.Conn())
+	}
+}
+
+// watch 监听连接c上的异常，直到连接断开或RabbitMQ客户端关闭
+// 连接异常断开时返回断开的原因，否则返回nil
+func (rmq *RabbitMQ) watch(c *connection) *external.XError {
+	// 监听者在连接建立时就已注册，恢复生产者/消费者期间连接断开也不会被当作主动关闭
+	closeChan, blockChan := c.notifications()
 
 	for {
 		select {
-		case xerr := <-closeChan:
+		case xerr, ok := <-closeChan:
+			if !ok {
+				select {
+				case <-rmq.closing:
+					// 连接被主动关闭
+					return nil
+				default:
+				}
+				// 连接在注册监听者之前已经断开，amqp直接关闭了监听者
+				return external.ErrClosed
+			}
 			// CRITICAL Exception (320) Reason: "CONNECTION_FORCED - broker forced connection closure with reason 'shutdown'"
 			// CRITICAL Exception (501) Reason: "read tcp 127.0.0.1:5672: i/o timeout"
 			// CRITICAL Exception (503) Reason: "COMMAND_INVALID - unimplemented method"
@@ -149,17 +471,87 @@ func (rmq *RabbitMQ) handleErrors(conn *external.XConnection) {
 			case external.ConnectionForced: // 320
 				log.Logger.Error("amqp.ConnectionForced")
 			}
-		case b := <-blockChan:
+			log.Logger.Errorf("RabbitMQ connection closed: %s", xerr)
+			return xerr
+		case b, ok := <-blockChan:
+			if !ok {
+				// 连接关闭时amqp会关闭blockChan，关闭原因由closeChan给出
+				blockChan = nil
+				continue
+			}
 			if b.Active {
-				log.Logger.Error("TCP blocked: %q", b.Reason)
+				log.Logger.Errorf("TCP blocked: %q", b.Reason)
+				c.setBlocked(true, b.Reason)
+				rmq.events.blocked(b.Reason)
 			} else {
 				log.Logger.Error("TCP unblocked")
+				c.setBlocked(false, "")
+				rmq.events.unblocked()
 			}
 		case _, ok := <-rmq.closing:
 			if !ok {
 				log.Logger.Warning("handleErrors recv rmq shutdown, return now.")
-				return
+				return nil
 			}
 		}
 	}
 }
+
+// closingContext 得到在RabbitMQ客户端关闭时被取消的ctx
+func (rmq *RabbitMQ) closingContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-rmq.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// reconnect 按照退避策略不断尝试重新建立连接
+// 重连成功返回true；RabbitMQ客户端关闭或超过最大重连次数时返回false
+func (rmq *RabbitMQ) reconnect(c *connection) bool {
+	policy := backoff{
+		Initial:    rmq.ReconnectInitialInterval,
+		Max:        rmq.ReconnectMaxInterval,
+		Multiplier: rmq.ReconnectMultiplier,
+		Jitter:     rmq.ReconnectJitter,
+	}
+
+	for attempt := 0; rmq.ReconnectMaxAttempts <= 0 || attempt < rmq.ReconnectMaxAttempts; attempt++ {
+		wait := policy.duration(attempt)
+		log.Logger.Warningf("RabbitMQ %s will reconnect after %s (attempt %d)", c, wait, attempt+1)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-rmq.closing:
+			timer.Stop()
+			log.Logger.Warning("reconnect recv rmq shutdown, return now.")
+			return false
+		}
+
+		// RabbitMQ客户端关闭时放弃正在进行的重连
+		ctx, cancel := rmq.closingContext()
+		err := rmq.dial(ctx, c)
+		cancel()
+		if err != nil {
+			select {
+			case <-rmq.closing:
+				log.Logger.Warning("reconnect recv rmq shutdown, return now.")
+				return false
+			default:
+			}
+			log.Logger.Errorf("RabbitMQ %s reconnect error: %s", c, err)
+			c.fail(err)
+			continue
+		}
+		log.Logger.Infof("RabbitMQ %s reconnect OK", c)
+		return true
+	}
+
+	log.Logger.Errorf("RabbitMQ %s reconnect gave up after %d attempts", c, rmq.ReconnectMaxAttempts)
+	return false
+}
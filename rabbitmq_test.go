@@ -0,0 +1,152 @@
+package xrabbitmq
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+)
+
+func TestDialerTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				time.Sleep(50 * time.Millisecond)
+				_, _ = conn.Write([]byte("x"))
+			}()
+		}
+	}()
+
+	cases := []struct {
+		name    string
+		timeout time.Duration
+		ok      bool
+	}{
+		{"no timeout", 0, true},
+		{"negative timeout", -time.Second, true},
+		{"long timeout", time.Second, true},
+		{"short timeout", 10 * time.Millisecond, false},
+	}
+	for _, c := range cases {
+		rmq := New(WithDialTimeout(c.timeout))
+		conn, err := rmq.dialer(context.Background(), nil)("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("%s: dial error: %s", c.name, err)
+		}
+		_, err = conn.Read(make([]byte, 1))
+		_ = conn.Close()
+		if ok := err == nil; ok != c.ok {
+			t.Errorf("%s: handshake read error = %v, want ok = %v", c.name, err, c.ok)
+		}
+	}
+}
+
+func TestDialEndpointCanceledDuringHandshake(t *testing.T) {
+	// 替身服务端接受连接后不再响应，AMQP握手会一直阻塞
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	rmq := New(WithDialTimeout(0))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	start := time.Now()
+	_, err = rmq.dialEndpoint(ctx, rmq.conns.all[0], endpoint{host: "127.0.0.1", port: port})
+	if err != context.Canceled {
+		t.Errorf("dialEndpoint error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("dialEndpoint returned after %s, want it interrupted by ctx", elapsed)
+	}
+}
+
+func TestWatchClosedListener(t *testing.T) {
+	cases := []struct {
+		name     string
+		shutdown bool
+		want     *external.XError
+	}{
+		// 连接在注册监听者之前已经断开，需要重连
+		{"dropped before registered", false, external.ErrClosed},
+		// RabbitMQ客户端关闭时主动关闭连接，不再重连
+		{"shutdown", true, nil},
+	}
+	for _, c := range cases {
+		rmq := New()
+		if c.shutdown {
+			close(rmq.closing)
+		}
+		conn := &connection{
+			closes: make(chan *external.XError),
+			blocks: make(chan external.XBlocking),
+		}
+		close(conn.closes)
+		close(conn.blocks)
+		if got := rmq.watch(conn); got != c.want {
+			t.Errorf("%s: watch = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// waitingClient 排空时一直等待会话恢复的生产者替身
+type waitingClient struct {
+	sess *session.Session
+}
+
+func (c *waitingClient) Sess() *session.Session {
+	return c.sess
+}
+
+func (c *waitingClient) Drain(ctx context.Context) error {
+	select {
+	case <-c.sess.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestShutdownWithLostConnection(t *testing.T) {
+	rmq := New()
+	c := rmq.conns.all[0]
+	c.clients.Register(&waitingClient{sess: session.NewSession()})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rmq.Shutdown()
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "lost during shutdown") {
+			t.Errorf("Shutdown error = %v, want connection lost", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown blocked on a producer waiting for a connection that will never recover")
+	}
+}
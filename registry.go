@@ -0,0 +1,112 @@
+package xrabbitmq
+
+import (
+	"context"
+	"sync"
+	"xrabbitmq/build"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/log"
+)
+
+// registry 登记了通过RabbitMQ客户端构建出来的所有生产者/消费者
+// 断线重连后，会在新的连接上为它们的会话重建通信管道；关闭时会依次排空它们
+type registry struct {
+	mu sync.Mutex
+
+	clients []build.Client
+}
+
+// Register 登记生产者/消费者，同时移除已经关闭的
+func (r *registry) Register(c build.Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune()
+	r.clients = append(r.clients, c)
+}
+
+// prune 移除会话已关闭的生产者/消费者，调用者需持有锁
+func (r *registry) prune() {
+	alive := r.clients[:0]
+	for _, c := range r.clients {
+		if !c.Sess().Closed() {
+			alive = append(alive, c)
+		}
+	}
+	for i := len(alive); i < len(r.clients); i++ {
+		r.clients[i] = nil
+	}
+	r.clients = alive
+}
+
+// snapshot 得到当前仍然存活的生产者/消费者
+func (r *registry) snapshot() []build.Client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune()
+	return append([]build.Client(nil), r.clients...)
+}
+
+// recover 在新的连接上恢复所有未关闭的会话
+func (r *registry) recover(conn *external.XConnection) {
+	for _, c := range r.snapshot() {
+		if err := c.Sess().Recover(conn); err != nil {
+			log.Logger.Errorf("%s", err)
+		}
+	}
+}
+
+// drain 先排空所有消费者，再排空所有生产者
+// 返回ctx到期时被放弃的情况
+func drain(ctx context.Context, clients []build.Client) []error {
+	var (
+		consumers, producers []build.Client
+		errs                 []error
+	)
+	for _, c := range clients {
+		if _, ok := c.(external.Consumer); ok {
+			consumers = append(consumers, c)
+		} else {
+			producers = append(producers, c)
+		}
+	}
+
+	for _, group := range [][]build.Client{consumers, producers} {
+		for _, err := range drainAll(ctx, group) {
+			log.Logger.Warningf("RabbitMQ shutdown: %s", err)
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// drainAll 并发排空一组生产者/消费者
+func drainAll(ctx context.Context, clients []build.Client) []error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c build.Client) {
+			defer wg.Done()
+			if err := c.Drain(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	return errs
+}
+
+// close 关闭所有会话，唤醒仍在等待会话恢复的生产者/消费者
+func (r *registry) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.clients {
+		c.Sess().Close()
+	}
+	r.clients = nil
+}
@@ -0,0 +1,107 @@
+package xrabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"xrabbitmq/build"
+	"xrabbitmq/pkg/external"
+	"xrabbitmq/pkg/session"
+)
+
+// drainRecorder 记录排空的顺序
+type drainRecorder struct {
+	mu      sync.Mutex
+	drained []string
+}
+
+func (r *drainRecorder) record(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.drained = append(r.drained, name)
+}
+
+// fakeProducer 排空时记录自己的生产者替身
+type fakeProducer struct {
+	name     string
+	sess     *session.Session
+	recorder *drainRecorder
+	err      error
+}
+
+func (p *fakeProducer) Sess() *session.Session {
+	return p.sess
+}
+
+func (p *fakeProducer) Drain(ctx context.Context) error {
+	p.recorder.record(p.name)
+	return p.err
+}
+
+// fakeConsumer 实现了external.Consumer的消费者替身，只用到Sess/Drain
+type fakeConsumer struct {
+	external.Consumer
+	fakeProducer
+}
+
+func TestRegistryPrune(t *testing.T) {
+	var r registry
+	sessions := []*session.Session{session.NewSession(), session.NewSession(), session.NewSession()}
+	for _, sess := range sessions {
+		r.Register(&fakeProducer{sess: sess})
+	}
+	sessions[1].Close()
+
+	clients := r.snapshot()
+	if len(clients) != 2 {
+		t.Fatalf("snapshot has %d clients, want 2", len(clients))
+	}
+	for _, c := range clients {
+		if c.Sess() == sessions[1] {
+			t.Error("snapshot kept a closed session")
+		}
+	}
+
+	r.close()
+	for i, sess := range sessions {
+		if !sess.Closed() {
+			t.Errorf("session %d not closed by registry close", i)
+		}
+	}
+	if len(r.snapshot()) != 0 {
+		t.Error("registry not empty after close")
+	}
+}
+
+func TestDrainConsumersFirst(t *testing.T) {
+	errAbandoned := errors.New("abandoned")
+	recorder := &drainRecorder{}
+	producer := func(name string, err error) build.Client {
+		return &fakeProducer{name: name, recorder: recorder, err: err}
+	}
+	consumer := func(name string, err error) build.Client {
+		return &fakeConsumer{fakeProducer: fakeProducer{name: name, recorder: recorder, err: err}}
+	}
+
+	clients := []build.Client{
+		producer("p1", nil),
+		consumer("c1", nil),
+		producer("p2", errAbandoned),
+		consumer("c2", errAbandoned),
+	}
+	errs := drain(context.Background(), clients)
+
+	if len(errs) != 2 {
+		t.Errorf("drain errors = %v, want 2", errs)
+	}
+	if len(recorder.drained) != len(clients) {
+		t.Fatalf("drained %v, want all clients", recorder.drained)
+	}
+	for i, name := range recorder.drained {
+		if consumerDrained := name[0] == 'c'; consumerDrained != (i < 2) {
+			t.Errorf("drain order %v, want consumers before producers", recorder.drained)
+			break
+		}
+	}
+}
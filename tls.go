@@ -0,0 +1,53 @@
+package xrabbitmq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// useTLS 是否需要使用amqps协议建立连接
+func (opts *ConfOptions) useTLS() bool {
+	return opts.TLSConfig != nil || opts.CACertFile != "" || opts.CertFile != "" || opts.SASLExternal
+}
+
+// tlsConfig 根据配置项得到建立amqps连接所需的TLS配置
+// 以WithTLS传入的配置为基础，叠加从文件中加载的CA证书及客户端证书；
+// 不会修改WithTLS传入的配置及其中的证书池，在初始化时调用一次，每次建立连接时复用
+func (opts *ConfOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{}
+	if opts.TLSConfig != nil {
+		config = opts.TLSConfig.Clone()
+	}
+
+	if opts.CACertFile != "" {
+		pem, err := ioutil.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA cert file error: %w", err)
+		}
+		// Clone是浅拷贝，证书池需要复制后再追加
+		if config.RootCAs == nil {
+			config.RootCAs = x509.NewCertPool()
+		} else {
+			config.RootCAs = config.RootCAs.Clone()
+		}
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in CA cert file %q", opts.CACertFile)
+		}
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client cert/key error: %w", err)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+
+	if opts.SASLExternal && len(config.Certificates) == 0 && config.GetClientCertificate == nil {
+		return nil, fmt.Errorf("SASL EXTERNAL requires a client certificate")
+	}
+
+	return config, nil
+}